@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"github.com/google/martian/log"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"reflect"
+)
+
+// ApplyResult 描述 CreateOrUpdate 类操作对集群对象做了什么
+type ApplyResult int
+
+const (
+	ApplyUnchanged ApplyResult = iota
+	ApplyCreated
+	ApplyUpdated
+)
+
+func (r ApplyResult) Changed() bool {
+	return r != ApplyUnchanged
+}
+
+func (r ApplyResult) String() string {
+	switch r {
+	case ApplyCreated:
+		return "created"
+	case ApplyUpdated:
+		return "updated"
+	default:
+		return "unchanged"
+	}
+}
+
+// CreateOrUpdateNamespace 创建 namespace, 已存在时把 labels 合并进去, 不会删除已有的其他 label
+func (c *Conf) CreateOrUpdateNamespace(ctx context.Context, namespace string, labels map[string]string) (_ ApplyResult, err error) {
+	defer c.wrapError(&err, "CreateOrUpdateNamespace", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+
+	ns := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   namespace,
+			Labels: labels,
+		},
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+		},
+	}
+	result, err := applyObject[*v1.Namespace](ctx, clientset.CoreV1().Namespaces(), v1.Resource("namespaces"), ns, func(exist, body *v1.Namespace) (bool, error) {
+		return mergeLabels(exist, body.Labels), nil
+	})
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+	log.Infof("Namespace applied,namespace:%s,result:%s", namespace, result)
+	return result, nil
+}
+
+// CreateOrUpdateConfigMap 创建 configmap, 已存在时用 dataMap 覆盖原有数据
+func (c *Conf) CreateOrUpdateConfigMap(ctx context.Context, namespace string, configName string, dataMap map[string]string) (_ ApplyResult, err error) {
+	defer c.wrapError(&err, "CreateOrUpdateConfigMap", namespace, "")
+	body := &v1.ConfigMap{}
+	body.APIVersion = "v1"
+	body.Kind = "ConfigMap"
+	body.Data = dataMap
+	body.ObjectMeta = metav1.ObjectMeta{Name: configName}
+	return c.applyConfigMap(ctx, namespace, body)
+}
+
+// applyConfigMap 以 body 为准创建或覆盖 configmap 的 Data, body 中的 labels 合并到已有对象上
+func (c *Conf) applyConfigMap(ctx context.Context, namespace string, body *v1.ConfigMap) (ApplyResult, error) {
+	clientset, err := c.clientset()
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+
+	result, err := applyObject[*v1.ConfigMap](ctx, clientset.CoreV1().ConfigMaps(namespace), v1.Resource("configmaps"), body, func(exist, body *v1.ConfigMap) (bool, error) {
+		changed := false
+		if !(len(exist.Data) == 0 && len(body.Data) == 0) && !reflect.DeepEqual(exist.Data, body.Data) {
+			exist.Data = body.Data
+			changed = true
+		}
+		if mergeLabels(exist, body.Labels) {
+			changed = true
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+	log.Infof("ConfigMap applied,namespace:%s,name:%s,result:%s", namespace, body.Name, result)
+	return result, nil
+}
+
+// objectClient 是 client-go 类型化客户端共有的 Get/Create/Update 方法
+type objectClient[T metav1.Object] interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+	Create(ctx context.Context, obj T, opts metav1.CreateOptions) (T, error)
+	Update(ctx context.Context, obj T, opts metav1.UpdateOptions) (T, error)
+}
+
+// applyObject 不存在时创建 body, 已存在时由 merge 把自己管理的字段合并到 exist 上, 有变化才更新.
+// 并发创建或更新冲突时重新读取再合并
+func applyObject[T metav1.Object](ctx context.Context, client objectClient[T], resource schema.GroupResource, body T, merge func(exist, body T) (bool, error)) (ApplyResult, error) {
+	result := ApplyUnchanged
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		exist, getErr := client.Get(ctx, body.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(getErr) {
+			_, createErr := client.Create(ctx, body, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(createErr) {
+				return apierrors.NewConflict(resource, body.GetName(), createErr)
+			}
+			if createErr == nil {
+				result = ApplyCreated
+			}
+			return createErr
+		}
+		if getErr != nil {
+			return getErr
+		}
+
+		changed, mergeErr := merge(exist, body)
+		if mergeErr != nil {
+			return mergeErr
+		}
+		if !changed {
+			result = ApplyUnchanged
+			return nil
+		}
+		_, updateErr := client.Update(ctx, exist, metav1.UpdateOptions{})
+		if updateErr == nil {
+			result = ApplyUpdated
+		}
+		return updateErr
+	})
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+	return result, nil
+}
+
+// mergeLabels 把 labels 合并到 exist 上, 不删除已有的其他 label
+func mergeLabels(exist metav1.Object, labels map[string]string) bool {
+	merged := exist.GetLabels()
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	changed := false
+	for k, v := range labels {
+		if old, ok := merged[k]; !ok || old != v {
+			merged[k] = v
+			changed = true
+		}
+	}
+	exist.SetLabels(merged)
+	return changed
+}
@@ -0,0 +1,472 @@
+package client
+
+import (
+	"cicd_go/internal/atlas/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/martian/log"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"math"
+	"sort"
+)
+
+const (
+	// 与 HPA 默认值一致, 使用率偏离目标不超过 10% 时不伸缩
+	autoscalerTolerance = 0.1
+
+	autoscalerComponent = "autoscaler"
+	autoscalerSpecKey   = "spec"
+
+	podMetricsPath    = "/apis/metrics.k8s.io/v1beta1"
+	customMetricsPath = "/apis/custom.metrics.k8s.io/v1beta1"
+)
+
+// AutoscalerSpec 应用的自动伸缩配置. app pod 是没有控制器的裸 pod, HPA 无法伸缩,
+// 配置由 ApplyAutoscaler 保存在应用 namespace 的 ConfigMap 中, ReconcileAutoscaler 按 HPA 相同的算法
+// 计算期望实例数, 再通过 DeployAppInstance/DeleteAppPod 增删实例
+type AutoscalerSpec struct {
+	AppName     string `json:"app_name"`
+	MinReplicas int32  `json:"min_replicas"`
+	MaxReplicas int32  `json:"max_replicas"`
+
+	// 目标平均使用率, 相对容器 requests 的百分比, 为 0 表示不按该指标伸缩
+	TargetCPUUtilization    int32 `json:"target_cpu_utilization"`
+	TargetMemoryUtilization int32 `json:"target_memory_utilization"`
+
+	CustomMetrics []CustomMetricTarget `json:"custom_metrics"`
+}
+
+// CustomMetricTarget 按 pod 维度的自定义指标, 例如 qps, 从 custom.metrics.k8s.io 读取
+type CustomMetricTarget struct {
+	Name         string            `json:"name"`
+	AverageValue resource.Quantity `json:"average_value"`
+}
+
+// MetricStatus 一个指标的当前值和按该指标计算出的期望实例数
+type MetricStatus struct {
+	Name            string `json:"name"`
+	Current         string `json:"current"`
+	Target          string `json:"target"`
+	DesiredReplicas int32  `json:"desired_replicas"`
+}
+
+type AutoscalerStatus struct {
+	AppName         string         `json:"app_name"`
+	MinReplicas     int32          `json:"min_replicas"`
+	MaxReplicas     int32          `json:"max_replicas"`
+	CurrentReplicas int32          `json:"current_replicas"`
+	DesiredReplicas int32          `json:"desired_replicas"`
+	CurrentMetrics  []MetricStatus `json:"current_metrics"`
+}
+
+func autoscalerConfigMapName(appName string) string {
+	return getServiceFromAppName(appName) + "-" + autoscalerComponent
+}
+
+// BoundByQuota 把副本数限制在 CMDB 中该应用在环境下的实例配额以内
+func (s *AutoscalerSpec) BoundByQuota(quotas []model.AppQuota) error {
+	var limit int64
+	for _, quota := range quotas {
+		if quota.IsActive {
+			limit += quota.Number
+		}
+	}
+	if limit <= 0 {
+		return fmt.Errorf("app %s has no instance quota", s.AppName)
+	}
+	if s.MinReplicas <= 0 {
+		s.MinReplicas = 1
+	}
+	if int64(s.MinReplicas) > limit {
+		return fmt.Errorf("min replicas %d of app %s exceeds quota %d", s.MinReplicas, s.AppName, limit)
+	}
+	if s.MaxReplicas <= 0 || int64(s.MaxReplicas) > limit {
+		s.MaxReplicas = int32(limit)
+	}
+	if s.MaxReplicas < s.MinReplicas {
+		return fmt.Errorf("max replicas %d of app %s is less than min replicas %d", s.MaxReplicas, s.AppName, s.MinReplicas)
+	}
+	return nil
+}
+
+func (s *AutoscalerSpec) validate() error {
+	if s.MinReplicas <= 0 || s.MaxReplicas < s.MinReplicas {
+		return fmt.Errorf("invalid replicas range [%d, %d] of app %s", s.MinReplicas, s.MaxReplicas, s.AppName)
+	}
+	if s.TargetCPUUtilization <= 0 && s.TargetMemoryUtilization <= 0 && len(s.CustomMetrics) == 0 {
+		return fmt.Errorf("autoscaler of app %s has no metric target", s.AppName)
+	}
+	for _, custom := range s.CustomMetrics {
+		if len(custom.Name) == 0 || custom.AverageValue.Sign() <= 0 {
+			return fmt.Errorf("invalid custom metric %q of app %s", custom.Name, s.AppName)
+		}
+	}
+	return nil
+}
+
+// desiredReplicas 与 HPA 一致: ceil(有指标的实例数 * 当前值 / 目标值), 在容忍范围内保持不变.
+// 有实例缺少指标时, 扩容按这些实例为 ratioUp 的情况、缩容按 ratioDown 的情况重新计算,
+// 重新计算后落入容忍范围或伸缩方向改变时保持当前实例数
+func desiredReplicas(current, withMetrics, missing int32, ratio, ratioUp, ratioDown float64) int32 {
+	if math.Abs(ratio-1) <= autoscalerTolerance {
+		return current
+	}
+	if missing == 0 {
+		return int32(math.Ceil(float64(withMetrics) * ratio))
+	}
+	scaleUp := ratio > 1
+	if scaleUp {
+		ratio = ratioUp
+	} else {
+		ratio = ratioDown
+	}
+	if math.Abs(ratio-1) <= autoscalerTolerance || (ratio > 1) != scaleUp {
+		return current
+	}
+	return int32(math.Ceil(float64(withMetrics+missing) * ratio))
+}
+
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Containers []struct {
+			Name  string          `json:"name"`
+			Usage v1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+type customMetricValueList struct {
+	Items []struct {
+		DescribedObject struct {
+			Name string `json:"name"`
+		} `json:"describedObject"`
+		Value resource.Quantity `json:"value"`
+	} `json:"items"`
+}
+
+// ApplyAutoscaler 保存应用的自动伸缩配置, 调用前用 BoundByQuota 限制副本数
+func (c *Conf) ApplyAutoscaler(ctx context.Context, namespace string, spec *AutoscalerSpec) (_ ApplyResult, err error) {
+	defer c.wrapError(&err, "ApplyAutoscaler", namespace, spec.AppName)
+	if err = spec.validate(); err != nil {
+		return ApplyUnchanged, err
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+	body := &v1.ConfigMap{}
+	body.APIVersion = "v1"
+	body.Kind = "ConfigMap"
+	body.ObjectMeta = metav1.ObjectMeta{
+		Name:   autoscalerConfigMapName(spec.AppName),
+		Labels: map[string]string{"app": spec.AppName, "component": autoscalerComponent},
+	}
+	body.Data = map[string]string{autoscalerSpecKey: string(data)}
+	return c.applyConfigMap(ctx, namespace, body)
+}
+
+// GetAutoscaler 读取 ApplyAutoscaler 保存的配置, 没有配置时返回 NotFound
+func (c *Conf) GetAutoscaler(ctx context.Context, namespace, appName string) (_ *AutoscalerSpec, err error) {
+	defer c.wrapError(&err, "GetAutoscaler", namespace, appName)
+	clientset, err := c.clientset()
+	if err != nil {
+		return nil, err
+	}
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, autoscalerConfigMapName(appName), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return parseAutoscalerSpec(cm)
+}
+
+// ListAutoscalers 返回 namespace 下所有应用的自动伸缩配置, 供定时任务逐个 ReconcileAutoscaler
+func (c *Conf) ListAutoscalers(ctx context.Context, namespace string) (_ []*AutoscalerSpec, err error) {
+	defer c.wrapError(&err, "ListAutoscalers", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return nil, err
+	}
+	cms, err := clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{LabelSelector: "component=" + autoscalerComponent})
+	if err != nil {
+		return nil, err
+	}
+	var specs []*AutoscalerSpec
+	for i := range cms.Items {
+		spec, err := parseAutoscalerSpec(&cms.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func parseAutoscalerSpec(cm *v1.ConfigMap) (*AutoscalerSpec, error) {
+	spec := &AutoscalerSpec{}
+	err := json.Unmarshal([]byte(cm.Data[autoscalerSpecKey]), spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid autoscaler spec in configmap %s: %w", cm.Name, err)
+	}
+	return spec, nil
+}
+
+// GetAutoscalerStatus 按保存的配置读取应用实例的指标并计算期望实例数, 不做伸缩
+func (c *Conf) GetAutoscalerStatus(ctx context.Context, namespace, appName string) (_ *AutoscalerStatus, err error) {
+	defer c.wrapError(&err, "GetAutoscalerStatus", namespace, appName)
+	spec, err := c.GetAutoscaler(ctx, namespace, appName)
+	if err != nil {
+		return nil, err
+	}
+	status, _, err := c.autoscalerStatus(ctx, namespace, spec)
+	return status, err
+}
+
+// ReconcileAutoscaler 按保存的配置和指标把应用的实例数调整到期望值, 扩容使用 template 创建新实例, 缩容先删除最新创建的实例.
+// 由调用方定时执行, 扩容依赖 Conf.Instances 生成实例名
+func (c *Conf) ReconcileAutoscaler(ctx context.Context, template *AppPodTemplate) (_ *AutoscalerStatus, err error) {
+	defer c.wrapError(&err, "ReconcileAutoscaler", template.Namespace, template.AppName)
+	spec, err := c.GetAutoscaler(ctx, template.Namespace, template.AppName)
+	if err != nil {
+		return nil, err
+	}
+	status, pods, err := c.autoscalerStatus(ctx, template.Namespace, spec)
+	if err != nil {
+		return nil, err
+	}
+	if status.DesiredReplicas == status.CurrentReplicas {
+		return status, nil
+	}
+	log.Infof("Autoscaler scaling,namespace:%s,app:%s,from:%d,to:%d", template.Namespace, spec.AppName, status.CurrentReplicas, status.DesiredReplicas)
+
+	if status.DesiredReplicas > status.CurrentReplicas {
+		if c.Instances == nil {
+			return status, fmt.Errorf("scale up app %s requires an instance registry", spec.AppName)
+		}
+		for i := status.CurrentReplicas; i < status.DesiredReplicas; i++ {
+			instance := *template
+			instance.PodName = ""
+			instance.PodIP = ""
+			_, err = c.DeployAppInstance(ctx, &instance)
+			if err != nil {
+				return status, err
+			}
+		}
+		return status, nil
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+	})
+	for i := int32(0); i < status.CurrentReplicas-status.DesiredReplicas; i++ {
+		err = c.DeleteAppPod(ctx, pods[i].Namespace, pods[i].Name)
+		if err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// autoscalerStatus 返回状态以及参与计算的实例, 正在删除的 pod 不计入
+func (c *Conf) autoscalerStatus(ctx context.Context, namespace string, spec *AutoscalerSpec) (*AutoscalerStatus, []v1.Pod, error) {
+	if err := spec.validate(); err != nil {
+		return nil, nil, err
+	}
+	podList, err := c.QueryAppPods(ctx, namespace, map[string]string{"app": spec.AppName})
+	if err != nil {
+		return nil, nil, err
+	}
+	var pods []v1.Pod
+	for _, pod := range podList.Items {
+		if pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+
+	status := &AutoscalerStatus{
+		AppName:         spec.AppName,
+		MinReplicas:     spec.MinReplicas,
+		MaxReplicas:     spec.MaxReplicas,
+		CurrentReplicas: int32(len(pods)),
+	}
+	if status.CurrentReplicas == 0 {
+		status.DesiredReplicas = spec.MinReplicas
+		return status, pods, nil
+	}
+
+	if spec.TargetCPUUtilization > 0 || spec.TargetMemoryUtilization > 0 {
+		usages, err := c.podUsages(ctx, namespace, spec.AppName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if spec.TargetCPUUtilization > 0 {
+			status.CurrentMetrics = append(status.CurrentMetrics, utilizationStatus(v1.ResourceCPU, spec.TargetCPUUtilization, pods, usages, status.CurrentReplicas))
+		}
+		if spec.TargetMemoryUtilization > 0 {
+			status.CurrentMetrics = append(status.CurrentMetrics, utilizationStatus(v1.ResourceMemory, spec.TargetMemoryUtilization, pods, usages, status.CurrentReplicas))
+		}
+	}
+	for _, custom := range spec.CustomMetrics {
+		metric, err := c.customMetricStatus(ctx, namespace, spec.AppName, custom, pods, status.CurrentReplicas)
+		if err != nil {
+			return nil, nil, err
+		}
+		status.CurrentMetrics = append(status.CurrentMetrics, metric)
+	}
+
+	// 与 HPA 一样取各指标中最大的期望实例数
+	desired := status.CurrentReplicas
+	for i, metric := range status.CurrentMetrics {
+		if i == 0 || metric.DesiredReplicas > desired {
+			desired = metric.DesiredReplicas
+		}
+	}
+	if desired < spec.MinReplicas {
+		desired = spec.MinReplicas
+	}
+	if desired > spec.MaxReplicas {
+		desired = spec.MaxReplicas
+	}
+	status.DesiredReplicas = desired
+	return status, pods, nil
+}
+
+// podUsages 从 metrics-server 读取应用各 pod 所有容器的资源用量之和
+func (c *Conf) podUsages(ctx context.Context, namespace, appName string) (map[string]v1.ResourceList, error) {
+	clientset, err := c.clientset()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := clientset.Discovery().RESTClient().Get().
+		AbsPath(podMetricsPath, "namespaces", namespace, "pods").
+		Param("labelSelector", "app="+appName).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list podMetricsList
+	if err = json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	usages := make(map[string]v1.ResourceList)
+	for _, item := range list.Items {
+		total := v1.ResourceList{}
+		for _, container := range item.Containers {
+			for name, quantity := range container.Usage {
+				sum := total[name]
+				sum.Add(quantity)
+				total[name] = sum
+			}
+		}
+		usages[item.Metadata.Name] = total
+	}
+	return usages, nil
+}
+
+// utilizationStatus 使用率为有指标的 pod 用量之和除以其 requests 之和, 没有 requests 的 pod 不参与计算.
+// 缺少指标的 pod 扩容时按用量为 0、缩容时按用量等于 requests 计算
+func utilizationStatus(name v1.ResourceName, target int32, pods []v1.Pod, usages map[string]v1.ResourceList, current int32) MetricStatus {
+	metric := MetricStatus{Name: string(name), Target: fmt.Sprintf("%d%%", target), DesiredReplicas: current}
+	var usage, request, missingRequest int64
+	var withMetrics, missing int32
+	for _, pod := range pods {
+		var podRequest int64
+		for _, container := range pod.Spec.Containers {
+			quantity := container.Resources.Requests[name]
+			podRequest += quantity.MilliValue()
+		}
+		if podRequest == 0 {
+			continue
+		}
+		podUsage, ok := usages[pod.Name]
+		if !ok {
+			missingRequest += podRequest
+			missing++
+			continue
+		}
+		quantity := podUsage[name]
+		usage += quantity.MilliValue()
+		request += podRequest
+		withMetrics++
+	}
+	if request == 0 {
+		metric.Current = "unknown"
+		return metric
+	}
+	utilization := float64(usage) * 100 / float64(request)
+	metric.Current = fmt.Sprintf("%.0f%%", utilization)
+	ratio := utilization / float64(target)
+	ratioUp := float64(usage) * 100 / float64(request+missingRequest) / float64(target)
+	ratioDown := float64(usage+missingRequest) * 100 / float64(request+missingRequest) / float64(target)
+	metric.DesiredReplicas = desiredReplicas(current, withMetrics, missing, ratio, ratioUp, ratioDown)
+	return metric
+}
+
+// customMetricStatus 从 custom.metrics.k8s.io 读取应用各 pod 的指标并按平均值计算,
+// 缺少指标的 pod 扩容时按 0、缩容时按目标值计算
+func (c *Conf) customMetricStatus(ctx context.Context, namespace, appName string, custom CustomMetricTarget, pods []v1.Pod, current int32) (MetricStatus, error) {
+	metric := MetricStatus{Name: custom.Name, Target: custom.AverageValue.String(), DesiredReplicas: current}
+	clientset, err := c.clientset()
+	if err != nil {
+		return metric, err
+	}
+	raw, err := clientset.Discovery().RESTClient().Get().
+		AbsPath(customMetricsPath, "namespaces", namespace, "pods", "*", custom.Name).
+		Param("labelSelector", "app="+appName).
+		DoRaw(ctx)
+	if err != nil {
+		return metric, err
+	}
+	var list customMetricValueList
+	if err = json.Unmarshal(raw, &list); err != nil {
+		return metric, err
+	}
+	values := make(map[string]int64)
+	for _, item := range list.Items {
+		values[item.DescribedObject.Name] = item.Value.MilliValue()
+	}
+	metric.Current, metric.DesiredReplicas = averageValueStatus(values, custom.AverageValue.MilliValue(), pods, current)
+	return metric, nil
+}
+
+func averageValueStatus(values map[string]int64, target int64, pods []v1.Pod, current int32) (string, int32) {
+	var total int64
+	var withMetrics, missing int32
+	for _, pod := range pods {
+		value, ok := values[pod.Name]
+		if !ok {
+			missing++
+			continue
+		}
+		total += value
+		withMetrics++
+	}
+	if withMetrics == 0 || target == 0 {
+		return "unknown", current
+	}
+	average := resource.NewMilliQuantity(total/int64(withMetrics), resource.DecimalSI)
+	ratio := float64(total) / float64(withMetrics) / float64(target)
+	ratioUp := float64(total) / float64(withMetrics+missing) / float64(target)
+	ratioDown := float64(total+int64(missing)*target) / float64(withMetrics+missing) / float64(target)
+	return average.String(), desiredReplicas(current, withMetrics, missing, ratio, ratioUp, ratioDown)
+}
+
+// DeleteAutoscaler 删除应用的自动伸缩配置, 不改变当前实例数
+func (c *Conf) DeleteAutoscaler(ctx context.Context, namespace, appName string) (err error) {
+	defer c.wrapError(&err, "DeleteAutoscaler", namespace, appName)
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	err = clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, autoscalerConfigMapName(appName), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
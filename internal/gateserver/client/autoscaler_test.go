@@ -0,0 +1,72 @@
+package client
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func newMetricPods(names ...string) []v1.Pod {
+	var pods []v1.Pod
+	for _, name := range names {
+		pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		pod.Spec.Containers = []v1.Container{{Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+		}}}
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+func TestUtilizationStatus(t *testing.T) {
+	cpu := func(value string) v1.ResourceList {
+		return v1.ResourceList{v1.ResourceCPU: resource.MustParse(value)}
+	}
+	tests := []struct {
+		name   string
+		pods   []v1.Pod
+		usages map[string]v1.ResourceList
+		want   int32
+	}{
+		{name: "within tolerance", pods: newMetricPods("a", "b"), usages: map[string]v1.ResourceList{"a": cpu("500m"), "b": cpu("520m")}, want: 2},
+		{name: "scale up", pods: newMetricPods("a", "b"), usages: map[string]v1.ResourceList{"a": cpu("1"), "b": cpu("1")}, want: 4},
+		{name: "scale down", pods: newMetricPods("a", "b", "c", "d"), usages: map[string]v1.ResourceList{"a": cpu("100m"), "b": cpu("100m"), "c": cpu("100m"), "d": cpu("100m")}, want: 1},
+		{name: "missing pod counted idle on scale up", pods: newMetricPods("a", "b", "c", "d"),
+			usages: map[string]v1.ResourceList{"a": cpu("1"), "b": cpu("1"), "c": cpu("1")}, want: 6},
+		{name: "missing pods cancel scale up", pods: newMetricPods("a", "b", "c", "d"),
+			usages: map[string]v1.ResourceList{"a": cpu("900m"), "b": cpu("900m")}, want: 4},
+		{name: "missing pod counted busy on scale down", pods: newMetricPods("a", "b", "c", "d"),
+			usages: map[string]v1.ResourceList{"a": cpu("100m"), "b": cpu("100m"), "c": cpu("100m")}, want: 3},
+		{name: "no metrics", pods: newMetricPods("a", "b"), usages: map[string]v1.ResourceList{}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := utilizationStatus(v1.ResourceCPU, 50, tt.pods, tt.usages, int32(len(tt.pods)))
+			if got.DesiredReplicas != tt.want {
+				t.Errorf("utilizationStatus desired = %d (current %s), want %d", got.DesiredReplicas, got.Current, tt.want)
+			}
+		})
+	}
+}
+
+func TestAverageValueStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]int64
+		want   int32
+	}{
+		{name: "scale up", values: map[string]int64{"a": 200000, "b": 200000}, want: 4},
+		{name: "missing pod counted zero on scale up", values: map[string]int64{"a": 300000}, want: 3},
+		{name: "missing pod counted at target on scale down", values: map[string]int64{"a": 10000}, want: 2},
+		{name: "no metrics", values: map[string]int64{}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got := averageValueStatus(tt.values, 100000, newMetricPods("a", "b"), 2)
+			if got != tt.want {
+				t.Errorf("averageValueStatus desired = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/google/martian/log"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+)
+
+const (
+	ConfigVersionAnnotation = "config-version"
+
+	configLabelName    = "config"
+	configLabelVersion = "config-version"
+	configVersionLen   = 10
+)
+
+// AppConfig 应用的一个配置包, 以 configmap 存储, configmap 名称中带内容 hash, 内容变化即产生新版本
+type AppConfig struct {
+	Name string
+	Data map[string]string
+
+	// 非空时以文件形式挂载到该目录, 每个 key 一个文件
+	MountPath string
+
+	// 以环境变量形式注入, key 即变量名
+	AsEnv bool
+
+	// 版本变化时滚动重启应用的所有 pod
+	HotReload bool
+}
+
+// Version 按 key 排序后计算内容 hash
+func (cfg *AppConfig) Version() string {
+	keys := make([]string, 0, len(cfg.Data))
+	for k := range cfg.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(cfg.Data[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:configVersionLen]
+}
+
+func AppConfigMapName(appName string, cfg *AppConfig) string {
+	return getServiceFromAppName(appName) + "-" + cfg.Name + "-" + cfg.Version()
+}
+
+func appConfigVolumeName(cfg *AppConfig) string {
+	return "config-" + cfg.Name
+}
+
+// appConfigsVersion 汇总应用所有需要热更新的配置包版本, 写入 pod annotation 用来判断是否需要重启
+func appConfigsVersion(configs []*AppConfig) string {
+	var names []string
+	versions := make(map[string]string)
+	for _, cfg := range configs {
+		if !cfg.HotReload {
+			continue
+		}
+		names = append(names, cfg.Name)
+		versions[cfg.Name] = cfg.Version()
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(versions[name]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:configVersionLen]
+}
+
+// ApplyAppConfig 创建当前版本的配置 configmap, 同一版本重复调用不会产生变更
+func (c *Conf) ApplyAppConfig(ctx context.Context, namespace, appName string, cfg *AppConfig) (_ ApplyResult, err error) {
+	defer c.wrapError(&err, "ApplyAppConfig", namespace, appName)
+	body := &v1.ConfigMap{}
+	body.APIVersion = "v1"
+	body.Kind = "ConfigMap"
+	body.Data = cfg.Data
+
+	labels := make(map[string]string)
+	labels["app"] = appName
+	labels[configLabelName] = cfg.Name
+	labels[configLabelVersion] = cfg.Version()
+	body.ObjectMeta = metav1.ObjectMeta{Name: AppConfigMapName(appName, cfg), Labels: labels}
+
+	return c.applyConfigMap(ctx, namespace, body)
+}
+
+// PruneAppConfigs 删除应用中不再被 configs 和现有 pod 引用的旧版本 configmap.
+// 非热更新的配置变化时不会重启 pod, 旧 pod 仍挂载旧版本, 要等 pod 重建后才能删除
+func (c *Conf) PruneAppConfigs(ctx context.Context, namespace, appName string, configs []*AppConfig) (err error) {
+	defer c.wrapError(&err, "PruneAppConfigs", namespace, appName)
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool)
+	for _, cfg := range configs {
+		keep[AppConfigMapName(appName, cfg)] = true
+	}
+
+	pods, err := c.QueryAppPods(ctx, namespace, map[string]string{"app": appName})
+	if err != nil {
+		return err
+	}
+	for i := range pods.Items {
+		for _, name := range podConfigMapRefs(&pods.Items[i]) {
+			keep[name] = true
+		}
+	}
+
+	opts := metav1.ListOptions{}
+	opts.LabelSelector = "app=" + appName + "," + configLabelVersion
+	configMaps, err := clientset.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, cm := range configMaps.Items {
+		if keep[cm.Name] {
+			continue
+		}
+		err = c.DeleteConfigMap(ctx, namespace, cm.Name)
+		if err != nil {
+			return err
+		}
+		log.Infof("ConfigMap pruned,namespace:%s,name:%s", namespace, cm.Name)
+	}
+	return nil
+}
+
+// RolloutAppConfig 发布 template 中的配置包, 若热更新配置的版本变化, 逐个重建应用的 pod 并等待就绪, 最后清理旧版本
+func (c *Conf) RolloutAppConfig(ctx context.Context, template *AppPodTemplate) (err error) {
+	defer c.wrapError(&err, "RolloutAppConfig", template.Namespace, template.AppName)
+	for _, cfg := range template.Configs {
+		_, err := c.ApplyAppConfig(ctx, template.Namespace, template.AppName, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	version := appConfigsVersion(template.Configs)
+	if len(version) > 0 {
+		pods, err := c.QueryAppPods(ctx, template.Namespace, map[string]string{"app": template.AppName})
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods.Items {
+			if pod.Annotations[ConfigVersionAnnotation] == version {
+				continue
+			}
+			log.Infof("Config version changed,restarting pod,instanceName:%s,from:%s,to:%s", pod.Name, pod.Annotations[ConfigVersionAnnotation], version)
+
+			instance := *template
+			instance.PodName = pod.Labels["instance"]
+			instance.PodIP = pod.Labels["ip"]
+
+			propagationPolicy := metav1.DeletePropagationBackground
+			err = c.deleteAppPod(ctx, pod.Namespace, pod.Name, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+			if err != nil {
+				return err
+			}
+			err = c.WaitAppPodDeleted(ctx, pod.Namespace, pod.Name, podDeleteTimeout)
+			if err != nil {
+				return err
+			}
+			err = c.DeployAppPod(ctx, &instance)
+			if err != nil {
+				return err
+			}
+			err = c.WaitAppPodReady(ctx, instance.Namespace, instance.PodName, podReadinessTimeout)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.PruneAppConfigs(ctx, template.Namespace, template.AppName, template.Configs)
+}
+
+// podConfigMapRefs 返回 pod 通过 volume、envFrom、env 引用的所有 configmap
+func podConfigMapRefs(pod *v1.Pod) []string {
+	var names []string
+	for _, volume := range pod.Spec.Volumes {
+		if volume.ConfigMap != nil {
+			names = append(names, volume.ConfigMap.Name)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					names = append(names, source.ConfigMap.Name)
+				}
+			}
+		}
+	}
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				names = append(names, envFrom.ConfigMapRef.Name)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil {
+				names = append(names, env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+		}
+	}
+	return names
+}
+
+func createConfigVolumes(configs []*AppConfig, appName string) []v1.Volume {
+	var v1Volumes []v1.Volume
+	for _, cfg := range configs {
+		if len(cfg.MountPath) == 0 {
+			continue
+		}
+		v1Volume := v1.Volume{}
+		v1Volume.Name = appConfigVolumeName(cfg)
+		v1ConfigMapVolumeSource := &v1.ConfigMapVolumeSource{}
+		v1ConfigMapVolumeSource.Name = AppConfigMapName(appName, cfg)
+		v1Volume.ConfigMap = v1ConfigMapVolumeSource
+		v1Volumes = append(v1Volumes, v1Volume)
+	}
+	return v1Volumes
+}
+
+func createConfigVolumeMounts(configs []*AppConfig) []v1.VolumeMount {
+	var volumeMounts []v1.VolumeMount
+	for _, cfg := range configs {
+		if len(cfg.MountPath) == 0 {
+			continue
+		}
+		v1VolumeMount := v1.VolumeMount{}
+		v1VolumeMount.Name = appConfigVolumeName(cfg)
+		v1VolumeMount.MountPath = cfg.MountPath
+		v1VolumeMount.ReadOnly = true
+		volumeMounts = append(volumeMounts, v1VolumeMount)
+	}
+	return volumeMounts
+}
+
+func createConfigEnvFrom(configs []*AppConfig, appName string) []v1.EnvFromSource {
+	var envFrom []v1.EnvFromSource
+	for _, cfg := range configs {
+		if !cfg.AsEnv {
+			continue
+		}
+		source := v1.EnvFromSource{}
+		source.ConfigMapRef = &v1.ConfigMapEnvSource{}
+		source.ConfigMapRef.Name = AppConfigMapName(appName, cfg)
+		envFrom = append(envFrom, source)
+	}
+	return envFrom
+}
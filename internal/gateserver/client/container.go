@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ContainerStateWaiting    = "waiting"
+	ContainerStateRunning    = "running"
+	ContainerStateTerminated = "terminated"
+	ContainerStateUnknown    = "unknown"
+)
+
+// ContainerInfo pod 中一个容器或 init container 的状态
+type ContainerInfo struct {
+	Name         string `json:"name"`
+	Image        string `json:"image"`
+	Init         bool   `json:"init"`
+	App          bool   `json:"app"`
+	State        string `json:"state"`
+	Reason       string `json:"reason"`
+	Ready        bool   `json:"ready"`
+	RestartCount int32  `json:"restart_count"`
+}
+
+// resolveContainerName 未指定容器时使用应用容器, pod 中没有应用容器时使用第一个容器
+func (c *Conf) resolveContainerName(ctx context.Context, namespace, podName, containerName string) (string, error) {
+	if len(containerName) > 0 {
+		return containerName, nil
+	}
+	clientset, err := c.clientset()
+	if err != nil {
+		return "", err
+	}
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return defaultContainerName(pod)
+}
+
+func defaultContainerName(pod *v1.Pod) (string, error) {
+	appContainerName := AppContainerName(pod.Labels["app"])
+	for _, container := range pod.Spec.Containers {
+		if container.Name == appContainerName {
+			return container.Name, nil
+		}
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return "", fmt.Errorf("pod %s has no container", pod.Name)
+	}
+	return pod.Spec.Containers[0].Name, nil
+}
+
+// ListPodContainers 列出 pod 的 init container 和容器及其当前状态
+func (c *Conf) ListPodContainers(ctx context.Context, namespace, podName string) (_ []ContainerInfo, err error) {
+	defer c.wrapError(&err, "ListPodContainers", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return nil, err
+	}
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	appContainerName := AppContainerName(pod.Labels["app"])
+	var infos []ContainerInfo
+	for _, container := range pod.Spec.InitContainers {
+		info := ContainerInfo{Name: container.Name, Image: container.Image, Init: true}
+		fillContainerStatus(&info, pod.Status.InitContainerStatuses)
+		infos = append(infos, info)
+	}
+	for _, container := range pod.Spec.Containers {
+		info := ContainerInfo{Name: container.Name, Image: container.Image, App: container.Name == appContainerName}
+		fillContainerStatus(&info, pod.Status.ContainerStatuses)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func fillContainerStatus(info *ContainerInfo, statuses []v1.ContainerStatus) {
+	info.State = ContainerStateUnknown
+	for _, status := range statuses {
+		if status.Name != info.Name {
+			continue
+		}
+		info.Ready = status.Ready
+		info.RestartCount = status.RestartCount
+		switch {
+		case status.State.Waiting != nil:
+			info.State = ContainerStateWaiting
+			info.Reason = status.State.Waiting.Reason
+		case status.State.Running != nil:
+			info.State = ContainerStateRunning
+		case status.State.Terminated != nil:
+			info.State = ContainerStateTerminated
+			info.Reason = status.State.Terminated.Reason
+		}
+		return
+	}
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"github.com/google/martian/log"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"reflect"
+	"strconv"
+)
+
+const disruptionHaAnnotation = "enable-ha"
+
+// disruptionMinAvailable 高可用应用一次只允许一个实例被驱逐, 其他应用最多一半实例同时不可用.
+// app pod 没有控制器, PDB 只支持整数的 minAvailable, 所以实例数变化后需要重新同步
+func disruptionMinAvailable(instances int32, enableHa bool) intstr.IntOrString {
+	allowed := int32(1)
+	if !enableHa && instances > 2 {
+		allowed = instances / 2
+	}
+	return intstr.FromInt(int(instances - allowed))
+}
+
+// ApplyAppDisruptionBudget 按实例数创建或更新应用的 PodDisruptionBudget
+func (c *Conf) ApplyAppDisruptionBudget(ctx context.Context, namespace, appName string, instances int32, enableHa bool) (_ ApplyResult, err error) {
+	defer c.wrapError(&err, "ApplyAppDisruptionBudget", namespace, appName)
+	clientset, err := c.clientset()
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+
+	body := &policyv1.PodDisruptionBudget{}
+	body.APIVersion = "policy/v1"
+	body.Kind = "PodDisruptionBudget"
+	body.ObjectMeta = metav1.ObjectMeta{
+		Name:        getServiceFromAppName(appName),
+		Namespace:   namespace,
+		Labels:      map[string]string{"app": appName},
+		Annotations: map[string]string{disruptionHaAnnotation: strconv.FormatBool(enableHa)},
+	}
+	minAvailable := disruptionMinAvailable(instances, enableHa)
+	body.Spec.MinAvailable = &minAvailable
+	body.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": appName}}
+
+	result, err := applyObject[*policyv1.PodDisruptionBudget](ctx, clientset.PolicyV1().PodDisruptionBudgets(namespace), policyv1.Resource("poddisruptionbudgets"), body, func(exist, body *policyv1.PodDisruptionBudget) (bool, error) {
+		if reflect.DeepEqual(exist.Spec.MinAvailable, body.Spec.MinAvailable) && exist.Spec.MaxUnavailable == nil &&
+			reflect.DeepEqual(exist.Spec.Selector, body.Spec.Selector) && exist.Annotations[disruptionHaAnnotation] == body.Annotations[disruptionHaAnnotation] {
+			return false, nil
+		}
+		exist.Spec.MinAvailable = body.Spec.MinAvailable
+		exist.Spec.MaxUnavailable = nil
+		exist.Spec.Selector = body.Spec.Selector
+		if exist.Annotations == nil {
+			exist.Annotations = make(map[string]string)
+		}
+		exist.Annotations[disruptionHaAnnotation] = body.Annotations[disruptionHaAnnotation]
+		return true, nil
+	})
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+	log.Infof("PodDisruptionBudget applied,namespace:%s,app:%s,minAvailable:%s,result:%s", namespace, appName, minAvailable.String(), result)
+	return result, nil
+}
+
+// SyncAppDisruptionBudget 按应用当前的实例数更新 PodDisruptionBudget, 扩缩容后调用
+func (c *Conf) SyncAppDisruptionBudget(ctx context.Context, namespace, appName string, enableHa bool) (_ ApplyResult, err error) {
+	defer c.wrapError(&err, "SyncAppDisruptionBudget", namespace, appName)
+	pods, err := c.QueryAppPods(ctx, namespace, map[string]string{"app": appName})
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+	var instances int32
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			instances++
+		}
+	}
+	if instances == 0 {
+		return ApplyUnchanged, c.DeleteAppDisruptionBudget(ctx, namespace, appName)
+	}
+	return c.ApplyAppDisruptionBudget(ctx, namespace, appName, instances, enableHa)
+}
+
+// resyncAppDisruptionBudget 实例删除后按剩余实例数更新 PodDisruptionBudget, 高可用设置沿用已有 PDB 上的记录
+func (c *Conf) resyncAppDisruptionBudget(ctx context.Context, namespace, appName string) error {
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	exist, err := clientset.PolicyV1().PodDisruptionBudgets(namespace).Get(ctx, getServiceFromAppName(appName), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	enableHa, _ := strconv.ParseBool(exist.Annotations[disruptionHaAnnotation])
+	_, err = c.SyncAppDisruptionBudget(ctx, namespace, appName, enableHa)
+	return err
+}
+
+func (c *Conf) DeleteAppDisruptionBudget(ctx context.Context, namespace, appName string) (err error) {
+	defer c.wrapError(&err, "DeleteAppDisruptionBudget", namespace, appName)
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	err = clientset.PolicyV1().PodDisruptionBudgets(namespace).Delete(ctx, getServiceFromAppName(appName), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestDisruptionMinAvailable(t *testing.T) {
+	tests := []struct {
+		instances int32
+		enableHa  bool
+		want      int
+	}{
+		{instances: 1, want: 0},
+		{instances: 2, want: 1},
+		{instances: 3, want: 2},
+		{instances: 4, want: 2},
+		{instances: 9, want: 5},
+		{instances: 1, enableHa: true, want: 0},
+		{instances: 4, enableHa: true, want: 3},
+		{instances: 9, enableHa: true, want: 8},
+	}
+	for _, tt := range tests {
+		got := disruptionMinAvailable(tt.instances, tt.enableHa)
+		if got.IntValue() != tt.want {
+			t.Errorf("disruptionMinAvailable(%d, %v) = %s, want %d", tt.instances, tt.enableHa, got.String(), tt.want)
+		}
+	}
+}
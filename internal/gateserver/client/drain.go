@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/martian/log"
+	"k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"time"
+)
+
+const (
+	DrainPhaseSkipped   = "skipped"
+	DrainPhaseEvicting  = "evicting"
+	DrainPhaseEvicted   = "evicted"
+	DrainPhaseRecreated = "recreated"
+	DrainPhaseFailed    = "failed"
+
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+	evictionRetryInterval  = 5 * time.Second
+	defaultEvictionTimeout = 10 * time.Minute
+)
+
+type DrainOptions struct {
+	// 单个 pod 的驱逐超时, PodDisruptionBudget 不允许时会一直重试到超时, 为 0 时为 10 分钟
+	EvictionTimeout time.Duration
+
+	GracePeriodSeconds *int64
+
+	// 返回裸 app pod 对应的模板, 驱逐后按模板在其他节点重建; 为 nil 时只驱逐不重建
+	TemplateFor func(pod *v1.Pod) (*AppPodTemplate, error)
+
+	// 每个 pod 状态变化时回调
+	Progress func(status DrainPodStatus)
+}
+
+type DrainPodStatus struct {
+	Namespace string
+	PodName   string
+	Phase     string
+	Err       error
+}
+
+func (c *Conf) Cordon(ctx context.Context, hostIP string) (err error) {
+	defer c.wrapError(&err, "Cordon", "", "")
+	return c.setNodeUnschedulable(ctx, hostIP, true)
+}
+
+func (c *Conf) Uncordon(ctx context.Context, hostIP string) (err error) {
+	defer c.wrapError(&err, "Uncordon", "", "")
+	return c.setNodeUnschedulable(ctx, hostIP, false)
+}
+
+func (c *Conf) setNodeUnschedulable(ctx context.Context, hostIP string, unschedulable bool) error {
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, getErr := c.GetNodeByIP(ctx, hostIP)
+		if getErr != nil {
+			return getErr
+		}
+		if node.Spec.Unschedulable == unschedulable {
+			return nil
+		}
+		node.Spec.Unschedulable = unschedulable
+		_, updateErr := clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		if updateErr == nil {
+			log.Infof("Node unschedulable changed,node:%s,unschedulable:%v", hostIP, unschedulable)
+		}
+		return updateErr
+	})
+}
+
+// Drain 封锁节点并逐个驱逐其上的 pod, 驱逐走 Eviction API 以遵守 PodDisruptionBudget,
+// 没有控制器的 app pod 驱逐后按模板以同样的实例名和 IP 在其他节点重建
+func (c *Conf) Drain(ctx context.Context, hostIP string, opts DrainOptions) (_ []DrainPodStatus, err error) {
+	defer c.wrapError(&err, "Drain", "", "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return nil, err
+	}
+	err = c.Cordon(ctx, hostIP)
+	if err != nil {
+		return nil, err
+	}
+	node, err := c.GetNodeByIP(ctx, hostIP)
+	if err != nil {
+		return nil, err
+	}
+
+	listOpts := metav1.ListOptions{FieldSelector: "spec.nodeName=" + node.Name}
+	podList, err := clientset.CoreV1().Pods(v1.NamespaceAll).List(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []DrainPodStatus
+	report := func(pod *v1.Pod, phase string, err error) {
+		status := DrainPodStatus{Namespace: pod.Namespace, PodName: pod.Name, Phase: phase, Err: err}
+		if phase != DrainPhaseEvicting {
+			statuses = append(statuses, status)
+		}
+		if opts.Progress != nil {
+			opts.Progress(status)
+		}
+	}
+
+	var failed int
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if skipDrain(pod) {
+			report(pod, DrainPhaseSkipped, nil)
+			continue
+		}
+
+		report(pod, DrainPhaseEvicting, nil)
+		err = c.evictPod(ctx, clientset, pod, opts)
+		if err != nil {
+			failed++
+			report(pod, DrainPhaseFailed, err)
+			continue
+		}
+
+		if opts.TemplateFor == nil || !isNakedAppPod(pod) {
+			report(pod, DrainPhaseEvicted, nil)
+			continue
+		}
+		err = c.recreateAppPod(ctx, pod, opts)
+		if err != nil {
+			failed++
+			report(pod, DrainPhaseFailed, err)
+			continue
+		}
+		report(pod, DrainPhaseRecreated, nil)
+	}
+
+	if failed > 0 {
+		return statuses, fmt.Errorf("drain node %s: %d pods failed", hostIP, failed)
+	}
+	log.Infof("Node drained,node:%s,pods:%d", hostIP, len(statuses))
+	return statuses, nil
+}
+
+func skipDrain(pod *v1.Pod) bool {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return true
+	}
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return true
+	}
+	controller := metav1.GetControllerOf(pod)
+	return controller != nil && controller.Kind == "DaemonSet"
+}
+
+// isNakedAppPod DeployAppPod 创建的 pod 没有控制器, 被驱逐后不会自动重建
+func isNakedAppPod(pod *v1.Pod) bool {
+	if metav1.GetControllerOf(pod) != nil {
+		return false
+	}
+	_, hasApp := pod.Labels["app"]
+	_, hasInstance := pod.Labels["instance"]
+	return hasApp && hasInstance
+}
+
+func (c *Conf) evictPod(ctx context.Context, clientset *kubernetes.Clientset, pod *v1.Pod, opts DrainOptions) error {
+	timeout := opts.EvictionTimeout
+	if timeout == 0 {
+		timeout = defaultEvictionTimeout
+	}
+	eviction := &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: opts.GracePeriodSeconds},
+	}
+	err := wait.PollImmediateWithContext(ctx, evictionRetryInterval, timeout, func(ctx context.Context) (bool, error) {
+		evictErr := clientset.CoreV1().Pods(pod.Namespace).EvictV1(ctx, eviction)
+		if evictErr == nil || apierrors.IsNotFound(evictErr) {
+			return true, nil
+		}
+		// PodDisruptionBudget 暂不允许驱逐, 等待其他实例就绪后重试
+		if apierrors.IsTooManyRequests(evictErr) {
+			log.Infof("Pod eviction blocked by disruption budget,instanceName:%s", pod.Name)
+			return false, nil
+		}
+		return false, evictErr
+	})
+	if err != nil {
+		return err
+	}
+	return c.WaitAppPodDeleted(ctx, pod.Namespace, pod.Name, podDeleteTimeout)
+}
+
+func (c *Conf) recreateAppPod(ctx context.Context, pod *v1.Pod, opts DrainOptions) error {
+	template, err := opts.TemplateFor(pod)
+	if err != nil {
+		return err
+	}
+	instance := *template
+	instance.Namespace = pod.Namespace
+	instance.PodName = pod.Labels["instance"]
+	instance.PodIP = pod.Labels["ip"]
+
+	err = c.DeployAppPod(ctx, &instance)
+	if err != nil {
+		return err
+	}
+	return c.WaitAppPodReady(ctx, instance.Namespace, instance.PodName, podReadinessTimeout)
+}
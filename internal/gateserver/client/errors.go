@@ -0,0 +1,21 @@
+package client
+
+import (
+	"cicd_go/internal/gateserver/client/errs"
+)
+
+// Cluster 返回用来标识集群的 apiserver 地址
+func (c *Conf) Cluster() string {
+	if len(c.K8sApiServer) > 0 {
+		return c.K8sApiServer
+	}
+	if c.RestConf != nil {
+		return c.RestConf.Host
+	}
+	return ""
+}
+
+// wrapError 配合 defer 使用, 把操作返回的错误转换为带集群、环境、namespace、应用上下文的 *errs.Error
+func (c *Conf) wrapError(err *error, op, namespace, appName string) {
+	*err = errs.Wrap(*err, op, c.Cluster(), c.Env, namespace, appName)
+}
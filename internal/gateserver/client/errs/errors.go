@@ -0,0 +1,185 @@
+// Package errs 定义 client.Conf 操作返回的错误类型, 调用方用 errors.Is 判断错误种类, 用 errors.As 取出集群、环境等上下文
+package errs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type Kind int
+
+const (
+	Unknown Kind = iota
+	NotFound
+	AlreadyExists
+	Conflict
+	Forbidden
+	QuotaExceeded
+	Timeout
+	ClusterUnreachable
+)
+
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrConflict           = errors.New("conflict")
+	ErrForbidden          = errors.New("forbidden")
+	ErrQuotaExceeded      = errors.New("quota exceeded")
+	ErrTimeout            = errors.New("timeout")
+	ErrClusterUnreachable = errors.New("cluster unreachable")
+)
+
+var kindSentinels = map[Kind]error{
+	NotFound:           ErrNotFound,
+	AlreadyExists:      ErrAlreadyExists,
+	Conflict:           ErrConflict,
+	Forbidden:          ErrForbidden,
+	QuotaExceeded:      ErrQuotaExceeded,
+	Timeout:            ErrTimeout,
+	ClusterUnreachable: ErrClusterUnreachable,
+}
+
+func (k Kind) String() string {
+	if sentinel, ok := kindSentinels[k]; ok {
+		return sentinel.Error()
+	}
+	return "unknown"
+}
+
+// Error 带上下文的操作错误, Err 为 client-go 返回的原始错误
+type Error struct {
+	Kind      Kind
+	Op        string
+	Cluster   string
+	Env       string
+	Namespace string
+	App       string
+	Err       error
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Op)
+	sb.WriteString(" failed,kind:")
+	sb.WriteString(e.Kind.String())
+	if len(e.Cluster) > 0 {
+		sb.WriteString(",cluster:")
+		sb.WriteString(e.Cluster)
+	}
+	if len(e.Env) > 0 {
+		sb.WriteString(",env:")
+		sb.WriteString(e.Env)
+	}
+	if len(e.Namespace) > 0 {
+		sb.WriteString(",namespace:")
+		sb.WriteString(e.Namespace)
+	}
+	if len(e.App) > 0 {
+		sb.WriteString(",app:")
+		sb.WriteString(e.App)
+	}
+	if e.Err != nil {
+		sb.WriteString(",err:")
+		sb.WriteString(e.Err.Error())
+	}
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 让 errors.Is(err, errs.ErrNotFound) 这类判断生效
+func (e *Error) Is(target error) bool {
+	sentinel, ok := kindSentinels[e.Kind]
+	return ok && sentinel == target
+}
+
+// Classify 按 apiserver 返回的状态和网络错误判断错误种类
+func Classify(err error) Kind {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+	for kind, sentinel := range kindSentinels {
+		if errors.Is(err, sentinel) {
+			return kind
+		}
+	}
+	switch {
+	case apierrors.IsNotFound(err):
+		return NotFound
+	case apierrors.IsAlreadyExists(err):
+		return AlreadyExists
+	case apierrors.IsConflict(err):
+		return Conflict
+	case apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota"):
+		return QuotaExceeded
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return Forbidden
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, wait.ErrWaitTimeout):
+		return Timeout
+	case apierrors.IsServiceUnavailable(err), isNetworkError(err):
+		return ClusterUnreachable
+	}
+	return Unknown
+}
+
+func isNetworkError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// Wrap 为错误补充上下文, 已经是 *Error 时只补充缺失的字段
+func Wrap(err error, op, cluster, env, namespace, app string) error {
+	if err == nil {
+		return nil
+	}
+	var typed *Error
+	if errors.As(err, &typed) {
+		if len(typed.Op) == 0 {
+			typed.Op = op
+		}
+		if len(typed.Cluster) == 0 {
+			typed.Cluster = cluster
+		}
+		if len(typed.Env) == 0 {
+			typed.Env = env
+		}
+		if len(typed.Namespace) == 0 {
+			typed.Namespace = namespace
+		}
+		if len(typed.App) == 0 {
+			typed.App = app
+		}
+		return err
+	}
+	return &Error{
+		Kind:      Classify(err),
+		Op:        op,
+		Cluster:   cluster,
+		Env:       env,
+		Namespace: namespace,
+		App:       app,
+		Err:       err,
+	}
+}
+
+func New(kind Kind, op string, err error) *Error {
+	return &Error{Kind: kind, Op: op, Err: err}
+}
@@ -0,0 +1,102 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestClassify(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	dialErr := &url.Error{Op: "Get", URL: "https://apiserver", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{name: "not found", err: apierrors.NewNotFound(pods, "p"), want: NotFound},
+		{name: "already exists", err: apierrors.NewAlreadyExists(pods, "p"), want: AlreadyExists},
+		{name: "conflict", err: apierrors.NewConflict(pods, "p", errors.New("modified")), want: Conflict},
+		{name: "forbidden", err: apierrors.NewForbidden(pods, "p", errors.New("rbac")), want: Forbidden},
+		{name: "unauthorized", err: apierrors.NewUnauthorized("token expired"), want: Forbidden},
+		{name: "quota exceeded", err: apierrors.NewForbidden(pods, "p", errors.New("exceeded quota: org-quota, requested: pods=1")), want: QuotaExceeded},
+		{name: "server timeout", err: apierrors.NewServerTimeout(pods, "create", 1), want: Timeout},
+		{name: "request timeout", err: apierrors.NewTimeoutError("slow", 1), want: Timeout},
+		{name: "context deadline", err: fmt.Errorf("list: %w", context.DeadlineExceeded), want: Timeout},
+		{name: "wait timeout", err: wait.ErrWaitTimeout, want: Timeout},
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("down"), want: ClusterUnreachable},
+		{name: "dial error", err: dialErr, want: ClusterUnreachable},
+		{name: "sentinel", err: fmt.Errorf("node: %w", ErrNotFound), want: NotFound},
+		{name: "typed", err: New(QuotaExceeded, "DeployAppPod", errors.New("full")), want: QuotaExceeded},
+		{name: "bad request", err: apierrors.NewBadRequest("invalid"), want: Unknown},
+		{name: "plain", err: errors.New("boom"), want: Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if Wrap(nil, "op", "cluster", "fat", "ns", "app") != nil {
+		t.Fatalf("Wrap(nil) is not nil")
+	}
+
+	origin := apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "order-fat-1")
+	err := Wrap(origin, "DeleteAppPod", "https://apiserver", "fat", "order", "order")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("errors.Is(err, ErrNotFound) = false")
+	}
+	if errors.Is(err, ErrConflict) {
+		t.Errorf("errors.Is(err, ErrConflict) = true")
+	}
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("apierrors.IsNotFound on wrapped error = false")
+	}
+	var typed *Error
+	if !errors.As(err, &typed) {
+		t.Fatalf("errors.As(err, *Error) = false")
+	}
+	if typed.Kind != NotFound || typed.Op != "DeleteAppPod" || typed.Cluster != "https://apiserver" ||
+		typed.Env != "fat" || typed.Namespace != "order" || typed.App != "order" {
+		t.Errorf("wrapped error context = %+v", typed)
+	}
+	for _, part := range []string{"DeleteAppPod", "kind:not found", "cluster:https://apiserver", "env:fat", "namespace:order"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("Error() = %q, missing %q", err.Error(), part)
+		}
+	}
+}
+
+func TestWrapKeepsInnerContext(t *testing.T) {
+	inner := New(NotFound, "", errors.New("node 10.0.0.1 not found"))
+	err := Wrap(inner, "Drain", "https://apiserver", "fat", "", "")
+	err = Wrap(err, "Outer", "other", "uat", "ns", "app")
+
+	var typed *Error
+	if !errors.As(err, &typed) {
+		t.Fatalf("errors.As(err, *Error) = false")
+	}
+	if typed != inner {
+		t.Errorf("Wrap of a typed error created a new error")
+	}
+	if typed.Op != "Drain" || typed.Cluster != "https://apiserver" || typed.Env != "fat" {
+		t.Errorf("outer Wrap overwrote context: %+v", typed)
+	}
+	if typed.Namespace != "ns" || typed.App != "app" {
+		t.Errorf("outer Wrap did not fill missing context: %+v", typed)
+	}
+}
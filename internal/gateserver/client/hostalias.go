@@ -0,0 +1,85 @@
+package client
+
+import (
+	"cicd_go/internal/gateserver/remote"
+	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// DefaultHostAliases 与 CentOS 默认 /etc/hosts 中的 localhost 条目一致
+func DefaultHostAliases() []v1.HostAlias {
+	return []v1.HostAlias{
+		{IP: "127.0.0.1", Hostnames: []string{"localhost.localdomain", "localhost4", "localhost4.localdomain4"}},
+		{IP: "::1", Hostnames: []string{"localhost.localdomain", "localhost6", "localhost6.localdomain6"}},
+	}
+}
+
+// HostAliasesFromEnv 转换 CMDB 中环境配置的 host 绑定, 例如内部服务域名固定解析到某个 IP
+func HostAliasesFromEnv(env *remote.ENV) []v1.HostAlias {
+	var hostAliases []v1.HostAlias
+	for _, alias := range env.HostAliases {
+		hostAliases = append(hostAliases, v1.HostAlias{IP: alias.IP, Hostnames: alias.Hostnames})
+	}
+	return hostAliases
+}
+
+func ValidateHostAliases(hostAliases []v1.HostAlias, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, alias := range hostAliases {
+		idxPath := fldPath.Index(i)
+		for _, msg := range validation.IsValidIP(alias.IP) {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("IP"), alias.IP, msg))
+		}
+		if len(alias.Hostnames) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("Hostnames"), ""))
+		}
+		for j, hostname := range alias.Hostnames {
+			for _, msg := range validation.IsDNS1123Subdomain(hostname) {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("Hostnames").Index(j), hostname, msg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// mergeHostAliases 按 IP 合并, 保持首次出现的顺序并去掉重复的 hostname
+func mergeHostAliases(groups ...[]v1.HostAlias) []v1.HostAlias {
+	var merged []v1.HostAlias
+	index := make(map[string]int)
+	for _, group := range groups {
+		for _, alias := range group {
+			i, ok := index[alias.IP]
+			if !ok {
+				index[alias.IP] = len(merged)
+				merged = append(merged, v1.HostAlias{IP: alias.IP})
+				i = len(merged) - 1
+			}
+			for _, hostname := range alias.Hostnames {
+				if !containsString(merged[i].Hostnames, hostname) {
+					merged[i].Hostnames = append(merged[i].Hostnames, hostname)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mutateHostAliases 写入 localhost 默认条目和环境配置的 host 绑定
+func mutateHostAliases(c *Conf, template *AppPodTemplate, pod *v1.Pod) error {
+	if errs := ValidateHostAliases(c.HostAliases, field.NewPath("HostAliases")); len(errs) > 0 {
+		return fmt.Errorf("invalid host aliases of env %s: %v", c.Env, errs.ToAggregate())
+	}
+	pod.Spec.HostAliases = mergeHostAliases(DefaultHostAliases(), pod.Spec.HostAliases, c.HostAliases)
+	return nil
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"bytes"
+	"cicd_go/internal/gateserver/remote"
+	"context"
+	"fmt"
+	"github.com/google/martian/log"
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	appServicePort = 8080
+)
+
+type appURL struct {
+	Host string
+	Path string
+	TLS  bool
+}
+
+// parseAppURL 解析 App.EnvUrlMap 中的地址, 没有 scheme 时按 http 处理
+func parseAppURL(rawURL string) (*appURL, error) {
+	raw := rawURL
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Hostname()) == 0 {
+		return nil, fmt.Errorf("url %s has no host", rawURL)
+	}
+	path := u.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+	return &appURL{Host: u.Hostname(), Path: path, TLS: u.Scheme == "https"}, nil
+}
+
+func defaultTLSSecretName(host string) string {
+	return strings.ReplaceAll(host, ".", "-") + "-tls"
+}
+
+// ApplyAppIngress 按 App.EnvUrlMap 中当前环境的地址创建或更新 Ingress, 后端为 CreateService 创建的 Service.
+// https 地址使用 tlsSecret 作为证书, 为空时为 <host>-tls
+func (c *Conf) ApplyAppIngress(ctx context.Context, namespace string, app *remote.App, tlsSecret string) (_ ApplyResult, err error) {
+	defer c.wrapError(&err, "ApplyAppIngress", namespace, app.Name)
+	rawURL, ok := app.EnvUrlMap[c.Env]
+	if !ok || len(rawURL) == 0 {
+		return ApplyUnchanged, fmt.Errorf("app %s has no url in env %s", app.Name, c.Env)
+	}
+	u, err := parseAppURL(rawURL)
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+	clientset, err := c.clientset()
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+
+	body := &networkingv1.Ingress{}
+	body.APIVersion = "networking.k8s.io/v1"
+	body.Kind = "Ingress"
+	body.ObjectMeta = metav1.ObjectMeta{
+		Name:      getServiceFromAppName(app.Name),
+		Namespace: namespace,
+		Labels:    map[string]string{"app": app.Name},
+	}
+	if len(c.IngressClass) > 0 {
+		ingressClass := c.IngressClass
+		body.Spec.IngressClassName = &ingressClass
+	}
+
+	pathType := networkingv1.PathTypePrefix
+	backend := networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{
+			Name: getServiceFromAppName(app.Name),
+			Port: networkingv1.ServiceBackendPort{Number: appServicePort},
+		},
+	}
+	rule := networkingv1.IngressRule{Host: u.Host}
+	rule.HTTP = &networkingv1.HTTPIngressRuleValue{
+		Paths: []networkingv1.HTTPIngressPath{{Path: u.Path, PathType: &pathType, Backend: backend}},
+	}
+	body.Spec.Rules = []networkingv1.IngressRule{rule}
+
+	if u.TLS {
+		secretName := tlsSecret
+		if len(secretName) == 0 {
+			secretName = defaultTLSSecretName(u.Host)
+		}
+		body.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{u.Host}, SecretName: secretName}}
+	}
+
+	result, err := applyObject[*networkingv1.Ingress](ctx, clientset.NetworkingV1().Ingresses(namespace), networkingv1.Resource("ingresses"), body, func(exist, body *networkingv1.Ingress) (bool, error) {
+		// 只比较和覆盖自己管理的字段, IngressClassName 为空时保留 DefaultIngressClass 准入插件在创建时设置的值
+		changed := false
+		if !reflect.DeepEqual(exist.Spec.Rules, body.Spec.Rules) {
+			exist.Spec.Rules = body.Spec.Rules
+			changed = true
+		}
+		if !reflect.DeepEqual(exist.Spec.TLS, body.Spec.TLS) {
+			exist.Spec.TLS = body.Spec.TLS
+			changed = true
+		}
+		if body.Spec.IngressClassName != nil && !reflect.DeepEqual(exist.Spec.IngressClassName, body.Spec.IngressClassName) {
+			exist.Spec.IngressClassName = body.Spec.IngressClassName
+			changed = true
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+	log.Infof("Ingress applied,namespace:%s,app:%s,url:%s,result:%s", namespace, app.Name, rawURL, result)
+	return result, nil
+}
+
+func (c *Conf) DeleteAppIngress(ctx context.Context, namespace, appName string) (err error) {
+	defer c.wrapError(&err, "DeleteAppIngress", namespace, appName)
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	err = clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, getServiceFromAppName(appName), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+var nginxUpstreamTemplate = template.Must(template.New("upstream").Parse(`# app: {{.AppName}}, env: {{.Env}}, nginx: {{.Nginx}}
+upstream {{.Upstream}} {
+{{- range .Servers}}
+    server {{.}};
+{{- end}}
+}
+
+server {
+    listen 80;
+    server_name {{.Host}};
+
+    location {{.Path}} {
+        proxy_pass http://{{.Upstream}};
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+    }
+}
+`))
+
+// RenderNginxUpstream 为使用 ENV.Nginx 而不是 ingress 的集群生成 nginx 配置片段, upstream 为应用就绪 pod 的 IP
+func RenderNginxUpstream(app *remote.App, env *remote.ENV, pods []v1.Pod) (string, error) {
+	if len(env.Nginx) == 0 {
+		return "", fmt.Errorf("env %s has no nginx", env.Name)
+	}
+	rawURL, ok := app.EnvUrlMap[env.Name]
+	if !ok || len(rawURL) == 0 {
+		return "", fmt.Errorf("app %s has no url in env %s", app.Name, env.Name)
+	}
+	u, err := parseAppURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	var servers []string
+	for i := range pods {
+		pod := &pods[i]
+		if len(pod.Status.PodIP) == 0 || !isPodReady(pod) {
+			continue
+		}
+		servers = append(servers, fmt.Sprintf("%s:%d", pod.Status.PodIP, appServicePort))
+	}
+	if len(servers) == 0 {
+		return "", fmt.Errorf("app %s has no ready pod in env %s", app.Name, env.Name)
+	}
+	sort.Strings(servers)
+
+	data := map[string]interface{}{
+		"AppName":  app.Name,
+		"Env":      env.Name,
+		"Nginx":    env.Nginx,
+		"Upstream": getServiceFromAppName(app.Name) + "-" + env.Name,
+		"Servers":  servers,
+		"Host":     u.Host,
+		"Path":     u.Path,
+	}
+	var buf bytes.Buffer
+	err = nginxUpstreamTemplate.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
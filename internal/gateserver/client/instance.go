@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/martian/log"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// InstanceRecord 实例名与 pod 的对应关系, 实例名即 pod 名
+type InstanceRecord struct {
+	Name      string
+	AppID     string
+	AppName   string
+	Env       string
+	Namespace string
+	IP        string
+}
+
+// InstanceRegistry 为应用生成稳定的实例名并记录实例所在的 pod
+type InstanceRegistry interface {
+	// Allocate 生成并占用一个新的实例名, 格式为 <app>-<env>-<序号>, 序号取最小的空闲值
+	Allocate(appID, appName, env string) (string, error)
+
+	// Bind 记录实例创建后所在的 namespace 和 IP, 实例名不是由 Allocate 生成时同时占用该名称
+	Bind(record InstanceRecord) error
+
+	Release(name string) error
+
+	ByAppID(appID string) []InstanceRecord
+
+	ByName(name string) (InstanceRecord, bool)
+
+	ByIP(ip string) (InstanceRecord, bool)
+}
+
+type MemoryInstanceRegistry struct {
+	lock    sync.RWMutex
+	records map[string]*InstanceRecord
+}
+
+func NewMemoryInstanceRegistry() *MemoryInstanceRegistry {
+	return &MemoryInstanceRegistry{records: make(map[string]*InstanceRecord)}
+}
+
+// sanitizeDNSLabel 转小写, 非法字符替换为 -, 并去掉首尾的 -
+func sanitizeDNSLabel(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('-')
+		}
+	}
+	return strings.Trim(sb.String(), "-")
+}
+
+func instanceName(appName, env string, index int) string {
+	suffix := "-" + strconv.Itoa(index)
+	prefix := getServiceFromAppName(sanitizeDNSLabel(appName))
+	if sanitized := sanitizeDNSLabel(env); len(sanitized) > 0 {
+		prefix += "-" + sanitized
+	}
+	if len(prefix)+len(suffix) > validation.DNS1123LabelMaxLength {
+		prefix = strings.TrimRight(prefix[:validation.DNS1123LabelMaxLength-len(suffix)], "-")
+	}
+	return prefix + suffix
+}
+
+func (r *MemoryInstanceRegistry) Allocate(appID, appName, env string) (string, error) {
+	if len(sanitizeDNSLabel(appName)) == 0 {
+		return "", fmt.Errorf("invalid app name %s", appName)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for index := 1; ; index++ {
+		name := instanceName(appName, env, index)
+		if _, used := r.records[name]; used {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return "", fmt.Errorf("invalid instance name %s: %s", name, strings.Join(errs, ","))
+		}
+		r.records[name] = &InstanceRecord{Name: name, AppID: appID, AppName: appName, Env: env}
+		return name, nil
+	}
+}
+
+func (r *MemoryInstanceRegistry) Bind(record InstanceRecord) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	exist, ok := r.records[record.Name]
+	if ok && exist.AppID != record.AppID {
+		return fmt.Errorf("instance %s belongs to app %s", record.Name, exist.AppID)
+	}
+	r.records[record.Name] = &record
+	return nil
+}
+
+func (r *MemoryInstanceRegistry) Release(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.records, name)
+	return nil
+}
+
+func (r *MemoryInstanceRegistry) ByAppID(appID string) []InstanceRecord {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var records []InstanceRecord
+	for _, record := range r.records {
+		if record.AppID == appID {
+			records = append(records, *record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Name < records[j].Name
+	})
+	return records
+}
+
+func (r *MemoryInstanceRegistry) ByName(name string) (InstanceRecord, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	record, ok := r.records[name]
+	if !ok {
+		return InstanceRecord{}, false
+	}
+	return *record, true
+}
+
+func (r *MemoryInstanceRegistry) ByIP(ip string) (InstanceRecord, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, record := range r.records {
+		if len(ip) > 0 && record.IP == ip {
+			return *record, true
+		}
+	}
+	return InstanceRecord{}, false
+}
+
+// allocateInstanceName 模板没有指定实例名时由注册中心生成. 注册中心只在内存中,
+// 每个应用第一次分配前先用集群中现有的 pod 刷新, 避免 gateserver 重启后生成已存在的实例名,
+// 之后由创建和删除实例时的 bindInstance/releaseInstance 维护
+func (c *Conf) allocateInstanceName(ctx context.Context, template *AppPodTemplate) (*AppPodTemplate, bool, error) {
+	if c.Instances == nil || len(template.PodName) > 0 {
+		return template, false, nil
+	}
+	if _, synced := c.instancesSynced.Load(template.Namespace + "/" + template.AppName); !synced {
+		err := c.SyncInstances(ctx, template.Namespace, template.AppName)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	name, err := c.Instances.Allocate(template.AppID, template.AppName, c.Env)
+	if err != nil {
+		return nil, false, err
+	}
+	instance := *template
+	instance.PodName = name
+	return &instance, true, nil
+}
+
+func (c *Conf) bindInstance(template *AppPodTemplate, ip string) error {
+	if c.Instances == nil {
+		return nil
+	}
+	return c.Instances.Bind(InstanceRecord{
+		Name:      template.PodName,
+		AppID:     template.AppID,
+		AppName:   template.AppName,
+		Env:       c.Env,
+		Namespace: template.Namespace,
+		IP:        ip,
+	})
+}
+
+func (c *Conf) releaseInstance(podName string) {
+	if c.Instances == nil {
+		return
+	}
+	err := c.Instances.Release(podName)
+	if err != nil {
+		log.Errorf("Instance release failed,instanceName:%s,err:%v", podName, err)
+	}
+}
+
+// SyncInstances 用应用当前的 pod 刷新实例记录, CNI 分配的 IP 在 pod 启动后才能拿到
+func (c *Conf) SyncInstances(ctx context.Context, namespace, appName string) (err error) {
+	defer c.wrapError(&err, "SyncInstances", namespace, appName)
+	if c.Instances == nil {
+		return nil
+	}
+	pods, err := c.QueryAppPods(ctx, namespace, map[string]string{"app": appName})
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		ip := pod.Status.PodIP
+		if len(ip) == 0 {
+			ip = pod.Labels["ip"]
+		}
+		err = c.Instances.Bind(InstanceRecord{
+			Name:      pod.Name,
+			AppID:     pod.Labels["appid"],
+			AppName:   appName,
+			Env:       c.Env,
+			Namespace: pod.Namespace,
+			IP:        ip,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	c.instancesSynced.Store(namespace+"/"+appName, true)
+	return nil
+}
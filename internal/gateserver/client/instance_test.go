@@ -0,0 +1,79 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstanceName(t *testing.T) {
+	longApp := strings.Repeat("order.service.", 6)
+	tests := []struct {
+		name    string
+		appName string
+		env     string
+		index   int
+		want    string
+	}{
+		{name: "plain", appName: "order", env: "fat", index: 1, want: "order-fat-1"},
+		{name: "dots and case", appName: "Order.Service", env: "UAT", index: 2, want: "order-service-uat-2"},
+		{name: "leading digit", appName: "1pay", env: "pro", index: 3, want: "s1pay-pro-3"},
+		{name: "empty env", appName: "order", env: "", index: 1, want: "order-1"},
+		{name: "invalid env chars", appName: "order", env: "_fat_", index: 1, want: "order-fat-1"},
+		{name: "truncate keeps suffix", appName: longApp, env: "fat", index: 12, want: "order-service-order-service-order-service-order-service-orde-12"},
+		{name: "truncate trims dash", appName: strings.Repeat("a", 60) + ".b", env: "fat", index: 1, want: strings.Repeat("a", 60) + "-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := instanceName(tt.appName, tt.env, tt.index)
+			if got != tt.want {
+				t.Errorf("instanceName(%q, %q, %d) = %q, want %q", tt.appName, tt.env, tt.index, got, tt.want)
+			}
+			if len(got) > 63 {
+				t.Errorf("instanceName length %d exceeds 63", len(got))
+			}
+		})
+	}
+}
+
+func TestMemoryInstanceRegistryAllocate(t *testing.T) {
+	r := NewMemoryInstanceRegistry()
+	for _, want := range []string{"order-fat-1", "order-fat-2", "order-fat-3"} {
+		got, err := r.Allocate("100", "order", "fat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Allocate = %s, want %s", got, want)
+		}
+	}
+
+	if err := r.Release("order-fat-2"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Allocate("100", "order", "fat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "order-fat-2" {
+		t.Errorf("Allocate after Release = %s, want the lowest free order-fat-2", got)
+	}
+
+	// 从集群同步回来的实例占用对应序号
+	if err := r.Bind(InstanceRecord{Name: "order-fat-4", AppID: "100", AppName: "order", Env: "fat"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.Allocate("100", "order", "fat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "order-fat-5" {
+		t.Errorf("Allocate after Bind = %s, want order-fat-5", got)
+	}
+
+	if _, err := r.Allocate("100", "...", "fat"); err == nil {
+		t.Errorf("Allocate with invalid app name succeeded")
+	}
+	if err := r.Bind(InstanceRecord{Name: "order-fat-1", AppID: "200"}); err == nil {
+		t.Errorf("Bind of another app's instance succeeded")
+	}
+}
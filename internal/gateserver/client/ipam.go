@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/martian/log"
+	"net/netip"
+	"sync"
+)
+
+const (
+	CalicoIPAddrsAnnotation = "cni.projectcalico.org/ipAddrs"
+)
+
+// IPAllocator 为实例分配固定 IP, 同一个实例在删除之前始终拿到同一个 IP
+type IPAllocator interface {
+	Allocate(namespace, instance string) (string, error)
+
+	// Reserve 占用调用方指定的 IP, 已被其他实例占用时返回错误
+	Reserve(namespace, instance, ip string) error
+
+	Release(namespace, instance string) error
+
+	Lookup(namespace, instance string) (string, bool)
+}
+
+// PodIPAnnotator 把分配到的 IP 转换为 CNI 插件识别的 pod annotation
+type PodIPAnnotator func(ip string) map[string]string
+
+func CalicoIPAnnotator(ip string) map[string]string {
+	ipAddrs, _ := json.Marshal([]string{ip})
+	return map[string]string{CalicoIPAddrsAnnotation: string(ipAddrs)}
+}
+
+// MemoryIPAM 基于单个网段的内存 IPAM, 进程重启后需要调用方按现有 pod 重新 Reserve
+type MemoryIPAM struct {
+	lock      sync.Mutex
+	prefix    netip.Prefix
+	excluded  map[netip.Addr]bool
+	instances map[string]netip.Addr
+	owners    map[netip.Addr]string
+}
+
+// NewMemoryIPAM cidr 为可分配网段, excluded 为网关等不能分配的地址
+func NewMemoryIPAM(cidr string, excluded ...string) (*MemoryIPAM, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ipam := &MemoryIPAM{
+		prefix:    prefix.Masked(),
+		excluded:  make(map[netip.Addr]bool),
+		instances: make(map[string]netip.Addr),
+		owners:    make(map[netip.Addr]string),
+	}
+	for _, ip := range excluded {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, err
+		}
+		ipam.excluded[addr] = true
+	}
+	return ipam, nil
+}
+
+func ipamKey(namespace, instance string) string {
+	return namespace + "/" + instance
+}
+
+func (m *MemoryIPAM) usable(addr netip.Addr) bool {
+	if !m.prefix.Contains(addr) || m.excluded[addr] {
+		return false
+	}
+	if addr.Is4() && m.prefix.Bits() < 31 {
+		// 网络地址和广播地址不分配, /31 和 /32 没有这两个地址
+		if addr == m.prefix.Addr() || !m.prefix.Contains(addr.Next()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MemoryIPAM) Allocate(namespace, instance string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := ipamKey(namespace, instance)
+	if addr, ok := m.instances[key]; ok {
+		return addr.String(), nil
+	}
+	for addr := m.prefix.Addr(); m.prefix.Contains(addr); addr = addr.Next() {
+		if !m.usable(addr) {
+			continue
+		}
+		if _, used := m.owners[addr]; used {
+			continue
+		}
+		m.instances[key] = addr
+		m.owners[addr] = key
+		log.Infof("IP allocated,instance:%s,ip:%s", key, addr.String())
+		return addr.String(), nil
+	}
+	return "", fmt.Errorf("no free ip in %s", m.prefix.String())
+}
+
+func (m *MemoryIPAM) Reserve(namespace, instance, ip string) error {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := ipamKey(namespace, instance)
+	if owner, used := m.owners[addr]; used {
+		if owner == key {
+			return nil
+		}
+		return fmt.Errorf("ip %s is already used by %s", ip, owner)
+	}
+	if !m.usable(addr) {
+		return fmt.Errorf("ip %s is not allocatable in %s", ip, m.prefix.String())
+	}
+	if old, ok := m.instances[key]; ok {
+		delete(m.owners, old)
+	}
+	m.instances[key] = addr
+	m.owners[addr] = key
+	return nil
+}
+
+func (m *MemoryIPAM) Release(namespace, instance string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := ipamKey(namespace, instance)
+	if addr, ok := m.instances[key]; ok {
+		delete(m.owners, addr)
+		delete(m.instances, key)
+		log.Infof("IP released,instance:%s,ip:%s", key, addr.String())
+	}
+	return nil
+}
+
+func (m *MemoryIPAM) Lookup(namespace, instance string) (string, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	addr, ok := m.instances[ipamKey(namespace, instance)]
+	if !ok {
+		return "", false
+	}
+	return addr.String(), true
+}
+
+// allocatePodIP 为模板分配或占用 IP, 返回带 IP 的模板副本. allocated 表示 IP 是本次新分配或新占用的,
+// 创建失败时需要释放; 实例原地重建时沿用已持有的 IP, 不算新分配
+func (c *Conf) allocatePodIP(template *AppPodTemplate) (*AppPodTemplate, bool, error) {
+	if c.IPAM == nil {
+		return template, false, nil
+	}
+	instance := *template
+	held, alreadyHeld := c.IPAM.Lookup(instance.Namespace, instance.PodName)
+	if len(instance.PodIP) > 0 {
+		err := c.IPAM.Reserve(instance.Namespace, instance.PodName, instance.PodIP)
+		if err != nil {
+			return nil, false, err
+		}
+		return &instance, !alreadyHeld || held != instance.PodIP, nil
+	}
+	ip, err := c.IPAM.Allocate(instance.Namespace, instance.PodName)
+	if err != nil {
+		return nil, false, err
+	}
+	instance.PodIP = ip
+	return &instance, !alreadyHeld, nil
+}
+
+func (c *Conf) releasePodIP(namespace, podName string) {
+	if c.IPAM == nil {
+		return
+	}
+	err := c.IPAM.Release(namespace, podName)
+	if err != nil {
+		log.Errorf("IP release failed,instanceName:%s,err:%v", podName, err)
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestMemoryIPAMAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cidr     string
+		excluded []string
+		want     []string
+	}{
+		{name: "skip network and broadcast", cidr: "10.0.0.0/30", want: []string{"10.0.0.1", "10.0.0.2"}},
+		{name: "skip excluded", cidr: "10.0.0.0/29", excluded: []string{"10.0.0.1", "10.0.0.3"}, want: []string{"10.0.0.2", "10.0.0.4", "10.0.0.5", "10.0.0.6"}},
+		{name: "point to point /31", cidr: "10.0.0.0/31", want: []string{"10.0.0.0", "10.0.0.1"}},
+		{name: "single host /32", cidr: "10.0.0.7/32", want: []string{"10.0.0.7"}},
+		{name: "unmasked cidr", cidr: "10.0.0.5/30", want: []string{"10.0.0.5", "10.0.0.6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipam, err := NewMemoryIPAM(tt.cidr, tt.excluded...)
+			if err != nil {
+				t.Fatalf("NewMemoryIPAM(%q) error: %v", tt.cidr, err)
+			}
+			for i, want := range tt.want {
+				got, err := ipam.Allocate("ns", "app-"+string(rune('a'+i)))
+				if err != nil {
+					t.Fatalf("Allocate #%d error: %v", i, err)
+				}
+				if got != want {
+					t.Errorf("Allocate #%d = %s, want %s", i, got, want)
+				}
+			}
+			if got, err := ipam.Allocate("ns", "overflow"); err == nil {
+				t.Errorf("Allocate on exhausted pool = %s, want error", got)
+			}
+		})
+	}
+}
+
+func TestMemoryIPAMAllocateIsStable(t *testing.T) {
+	ipam, err := NewMemoryIPAM("10.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := ipam.Allocate("ns", "app-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ipam.Allocate("ns", "app-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("Allocate for the same instance = %s then %s", first, second)
+	}
+	if ip, ok := ipam.Lookup("ns", "app-1"); !ok || ip != first {
+		t.Errorf("Lookup = %s,%v, want %s,true", ip, ok, first)
+	}
+
+	if err := ipam.Release("ns", "app-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ipam.Lookup("ns", "app-1"); ok {
+		t.Errorf("Lookup after Release found the instance")
+	}
+	again, err := ipam.Allocate("ns", "app-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Errorf("Allocate after Release = %s, want reused %s", again, first)
+	}
+}
+
+func TestMemoryIPAMReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		cidr     string
+		instance string
+		ip       string
+		wantErr  bool
+	}{
+		{name: "usable address", cidr: "10.0.0.0/24", instance: "app-2", ip: "10.0.0.20"},
+		{name: "same owner again", cidr: "10.0.0.0/24", instance: "app-1", ip: "10.0.0.10"},
+		{name: "owned by other instance", cidr: "10.0.0.0/24", instance: "app-2", ip: "10.0.0.10", wantErr: true},
+		{name: "network address", cidr: "10.0.0.0/24", instance: "app-2", ip: "10.0.0.0", wantErr: true},
+		{name: "broadcast address", cidr: "10.0.0.0/24", instance: "app-2", ip: "10.0.0.255", wantErr: true},
+		{name: "out of range", cidr: "10.0.0.0/24", instance: "app-2", ip: "10.0.1.1", wantErr: true},
+		{name: "excluded", cidr: "10.0.0.0/24", instance: "app-2", ip: "10.0.0.1", wantErr: true},
+		{name: "invalid ip", cidr: "10.0.0.0/24", instance: "app-2", ip: "10.0.0", wantErr: true},
+		{name: "/31 lower address", cidr: "10.0.0.0/31", instance: "app-2", ip: "10.0.0.0"},
+		{name: "/32 host", cidr: "10.0.0.10/32", instance: "app-1", ip: "10.0.0.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipam, err := NewMemoryIPAM(tt.cidr, "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ipam.prefix.Contains(mustParseAddr(t, "10.0.0.10")) {
+				if err := ipam.Reserve("ns", "app-1", "10.0.0.10"); err != nil {
+					t.Fatalf("Reserve app-1 error: %v", err)
+				}
+			}
+			err = ipam.Reserve("ns", tt.instance, tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reserve(%s, %s) error = %v, wantErr %v", tt.instance, tt.ip, err, tt.wantErr)
+			}
+			if err == nil {
+				if ip, ok := ipam.Lookup("ns", tt.instance); !ok || ip != tt.ip {
+					t.Errorf("Lookup = %s,%v, want %s,true", ip, ok, tt.ip)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryIPAMReserveMovesInstance(t *testing.T) {
+	ipam, err := NewMemoryIPAM("10.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve("ns", "app-1", "10.0.0.10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve("ns", "app-1", "10.0.0.11"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve("ns", "app-2", "10.0.0.10"); err != nil {
+		t.Errorf("old ip of a moved instance is still held: %v", err)
+	}
+}
+
+func mustParseAddr(t *testing.T, ip string) netip.Addr {
+	t.Helper()
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
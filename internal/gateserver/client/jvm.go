@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"strconv"
+	"strings"
+)
+
+// jvmOverhead 线程栈、code cache、GC 等 -Xmx 之外无法通过参数限定的内存
+var jvmOverhead = resource.MustParse("128Mi")
+
+// checkJavaOptsFit 检查 JAVA_TOOLS_OPTIONS 中显式指定的堆、元空间、直接内存加上 jvmOverhead 能否放进内存 limit.
+// 没有 -Xmx 时 JVM 按容器 limit 计算堆大小, 不需要检查
+func checkJavaOptsFit(javaOpts string, memoryLimit resource.Quantity) error {
+	var heap, metaspace, direct int64
+	for _, opt := range strings.Fields(javaOpts) {
+		var err error
+		switch {
+		case strings.HasPrefix(opt, "-Xmx"):
+			heap, err = parseJavaSize(strings.TrimPrefix(opt, "-Xmx"))
+		case strings.HasPrefix(opt, "-XX:MaxMetaspaceSize="):
+			metaspace, err = parseJavaSize(strings.TrimPrefix(opt, "-XX:MaxMetaspaceSize="))
+		case strings.HasPrefix(opt, "-XX:MaxDirectMemorySize="):
+			direct, err = parseJavaSize(strings.TrimPrefix(opt, "-XX:MaxDirectMemorySize="))
+		}
+		if err != nil {
+			return fmt.Errorf("invalid java option %s: %w", opt, err)
+		}
+	}
+	if heap == 0 {
+		return nil
+	}
+	required := heap + metaspace + direct + jvmOverhead.Value()
+	if required > memoryLimit.Value() {
+		return fmt.Errorf("java options %q need %s, memory limit is %s",
+			javaOpts, resource.NewQuantity(required, resource.BinarySI).String(), memoryLimit.String())
+	}
+	return nil
+}
+
+// parseJavaSize 解析 JVM 的内存参数, 单位为 k/m/g/t, 不区分大小写, 没有单位时为字节
+func parseJavaSize(size string) (int64, error) {
+	if len(size) == 0 {
+		return 0, fmt.Errorf("empty size")
+	}
+	multiplier := int64(1)
+	switch size[len(size)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	case 't', 'T':
+		multiplier = 1 << 40
+	}
+	if multiplier > 1 {
+		size = size[:len(size)-1]
+	}
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	"testing"
+)
+
+func TestParseJavaSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "1024", want: 1024},
+		{size: "512k", want: 512 << 10},
+		{size: "256m", want: 256 << 20},
+		{size: "2G", want: 2 << 30},
+		{size: "1t", want: 1 << 40},
+		{size: "", wantErr: true},
+		{size: "m", wantErr: true},
+		{size: "1.5g", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := parseJavaSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJavaSize(%q) error = %v, wantErr %v", tt.size, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseJavaSize(%q) = %d, want %d", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckJavaOptsFit(t *testing.T) {
+	tests := []struct {
+		name     string
+		javaOpts string
+		limit    string
+		wantErr  bool
+	}{
+		{name: "no heap option", javaOpts: "-XX:MaxRAMPercentage=75.0", limit: "256Mi"},
+		{name: "heap fits", javaOpts: "-Xms1g -Xmx1g", limit: "2Gi"},
+		{name: "heap plus overhead fits exactly", javaOpts: "-Xmx1920m", limit: "2Gi"},
+		{name: "heap plus overhead too large", javaOpts: "-Xmx1921m", limit: "2Gi", wantErr: true},
+		{name: "metaspace and direct counted", javaOpts: "-Xmx1g -XX:MaxMetaspaceSize=512m -XX:MaxDirectMemorySize=512m", limit: "2Gi", wantErr: true},
+		{name: "invalid size", javaOpts: "-Xmx1.5g", limit: "2Gi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkJavaOptsFit(tt.javaOpts, resource.MustParse(tt.limit))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkJavaOptsFit(%q, %s) error = %v, wantErr %v", tt.javaOpts, tt.limit, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,18 +2,23 @@ package client
 
 import (
 	"bytes"
+	"cicd_go/internal/gateserver/client/errs"
+	"cicd_go/internal/gateserver/remote"
 	"context"
+	"fmt"
 	"github.com/google/martian/log"
 	"io"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 )
 
@@ -31,6 +36,41 @@ type Conf struct {
 	Env string
 
 	RestConf *rest.Config
+
+	Zone string
+
+	// 环境级别的时区和语言, 为空时使用 DefaultTimezone/DefaultLocale
+	Timezone string
+	Locale   string
+
+	// 环境级别的 host 绑定, 追加在 DefaultHostAliases 之后
+	HostAliases []v1.HostAlias
+
+	// 非空时实例使用固定 IP, PodIPAnnotator 负责告诉 CNI 使用该 IP
+	IPAM           IPAllocator
+	PodIPAnnotator PodIPAnnotator
+
+	// 非空时由其生成实例名并记录实例与 pod 的对应关系
+	Instances InstanceRegistry
+
+	// 已经用集群中现有 pod 刷新过 Instances 的 namespace/app
+	instancesSynced sync.Map
+
+	// 为空时使用集群默认的 IngressClass
+	IngressClass string
+
+	// 为空时使用 DefaultMutatorPolicy
+	MutatorPolicy *MutatorPolicy
+
+	// 非空时创建 namespace 会同时创建镜像 pull secret, NewKubernetesConfFromEnv 从 ENV.DockerYard 解析
+	Registry *RegistryCredential
+
+	// 为空时使用 DefaultRetryPolicy/DefaultRateLimit, 同一集群的 Conf 共享限流
+	Retry     *RetryPolicy
+	RateLimit *RateLimit
+
+	restConfOnce sync.Once
+	restConf     *rest.Config
 }
 
 type PodHttpReadinessProbe struct {
@@ -84,18 +124,44 @@ type AppPodTemplate struct {
 	EnvJson   string
 	Sysctl    string
 	Flags     int64
+	Configs   []*AppConfig
+
+	// 为空时使用 ImagePullSecretName
+	ImagePullSecret string
+	SecretEnvs      []SecretEnv
+
+	// 应用级别的时区和语言, 优先于 Conf 中的配置
+	Timezone string
+	Locale   string
+
+	// 对应 App.EnableHa, 开启后没有配置的调度约束使用高可用默认值
+	EnableHa   bool
+	Scheduling Scheduling
+
+	// 固定主机名, 为空时由 PodName 生成
+	Hostname string
+
+	Shutdown Shutdown
+
+	Sidecars       []Sidecar
+	InitContainers []Sidecar
+	SharedVolumes  []SharedVolume
+
+	DataVolume *DataVolume
 }
 
-func (c *Conf) QueryAllPods(ctx context.Context) (*v1.PodList, error) {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) QueryAllPods(ctx context.Context) (_ *v1.PodList, err error) {
+	defer c.wrapError(&err, "QueryAllPods", "", "")
+	clientset, err := c.clientset()
 	if err != nil {
 		return nil, err
 	}
 	return clientset.CoreV1().Pods(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
 }
 
-func (c *Conf) QueryAllPodsWithLabel(ctx context.Context, labelSelectorMap map[string]string) (*v1.PodList, error) {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) QueryAllPodsWithLabel(ctx context.Context, labelSelectorMap map[string]string) (_ *v1.PodList, err error) {
+	defer c.wrapError(&err, "QueryAllPodsWithLabel", "", "")
+	clientset, err := c.clientset()
 	if err != nil {
 		return nil, err
 	}
@@ -107,8 +173,9 @@ func (c *Conf) QueryAllPodsWithLabel(ctx context.Context, labelSelectorMap map[s
 	return clientset.CoreV1().Pods(v1.NamespaceAll).List(ctx, opts)
 }
 
-func (c *Conf) QueryAppPods(ctx context.Context, namespace string, labelSelectorMap map[string]string) (*v1.PodList, error) {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) QueryAppPods(ctx context.Context, namespace string, labelSelectorMap map[string]string) (_ *v1.PodList, err error) {
+	defer c.wrapError(&err, "QueryAppPods", namespace, "")
+	clientset, err := c.clientset()
 	if err != nil {
 		return nil, err
 	}
@@ -135,22 +202,62 @@ func convert(labelSelectorMap map[string]string) string {
 	return labelSelect
 }
 
-func (c *Conf) DeployAppPod(ctx context.Context, temp *AppPodTemplate) error {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) DeployAppPod(ctx context.Context, temp *AppPodTemplate) (err error) {
+	defer c.wrapError(&err, "DeployAppPod", temp.Namespace, temp.AppName)
+	_, err = c.DeployAppInstance(ctx, temp)
+	return err
+}
+
+// DeployAppInstance 创建 pod 并返回实例名, 模板没有 PodName 时由 Conf.Instances 生成
+func (c *Conf) DeployAppInstance(ctx context.Context, temp *AppPodTemplate) (_ string, err error) {
+	defer c.wrapError(&err, "DeployAppInstance", temp.Namespace, temp.AppName)
+	clientset, err := c.clientset()
 	if err != nil {
-		return err
+		return "", err
+	}
+	named, nameAllocated, err := c.allocateInstanceName(ctx, temp)
+	if err != nil {
+		return "", err
 	}
-	pod := c.createPod(temp)
-	result, podCreateErr := clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
-	if podCreateErr != nil {
-		return podCreateErr
+	instance, ipAllocated, err := c.allocatePodIP(named)
+	if err != nil {
+		if nameAllocated {
+			c.releaseInstance(named.PodName)
+		}
+		return "", err
 	}
-	log.Infof("Pod created,result %s", result.String())
-	return nil
+	pod, err := c.RenderPod(instance)
+	if err == nil {
+		err = c.ensureAppPVC(ctx, instance)
+	}
+	if err == nil {
+		var result *v1.Pod
+		result, err = clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+		if err == nil {
+			log.Infof("Pod created,result %s", result.String())
+			err = c.bindInstance(instance, instance.PodIP)
+			if err != nil {
+				log.Errorf("Instance bind failed,instanceName:%s,err:%v", instance.PodName, err)
+			}
+			_, pdbErr := c.SyncAppDisruptionBudget(ctx, instance.Namespace, instance.AppName, instance.EnableHa)
+			if pdbErr != nil {
+				log.Errorf("PodDisruptionBudget sync failed,app:%s,err:%v", instance.AppName, pdbErr)
+			}
+			return instance.PodName, nil
+		}
+	}
+	if ipAllocated {
+		c.releasePodIP(instance.Namespace, instance.PodName)
+	}
+	if nameAllocated {
+		c.releaseInstance(instance.PodName)
+	}
+	return "", err
 }
 
-func (c *Conf) UpdateAppPod(ctx context.Context, dockerURL, namespace, podName, image string) error {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) UpdateAppPod(ctx context.Context, dockerURL, namespace, podName, image string) (err error) {
+	defer c.wrapError(&err, "UpdateAppPod", namespace, "")
+	clientset, err := c.clientset()
 	if err != nil {
 		return err
 	}
@@ -158,30 +265,71 @@ func (c *Conf) UpdateAppPod(ctx context.Context, dockerURL, namespace, podName,
 	return nil
 }
 
-func (c *Conf) DeleteAppPod(ctx context.Context, namespace, podName string) error {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) DeleteAppPod(ctx context.Context, namespace, podName string) (err error) {
+	defer c.wrapError(&err, "DeleteAppPod", namespace, "")
+	propagationPolicy := metav1.DeletePropagationBackground
+	dele := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+	return c.removeAppPod(ctx, namespace, podName, dele)
+}
+
+func (c *Conf) ForceDeleteAppPod(ctx context.Context, namespace, podName string) (err error) {
+	defer c.wrapError(&err, "ForceDeleteAppPod", namespace, "")
+	propagationPolicy := metav1.DeletePropagationBackground
+	// 宽限期为 0 跳过 preStop 和 SIGTERM 等待, 立即删除
+	gracePeriod := int64(0)
+	dele := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy, GracePeriodSeconds: &gracePeriod}
+	return c.removeAppPod(ctx, namespace, podName, dele)
+}
+
+// removeAppPod 删除实例后按剩余实例数同步 PodDisruptionBudget, 不等待 pod 彻底消失;
+// 实例名和固定 IP 由后台的 releaseAfterDeleted 释放
+func (c *Conf) removeAppPod(ctx context.Context, namespace, podName string, dele metav1.DeleteOptions) error {
+	clientset, err := c.clientset()
 	if err != nil {
 		return err
 	}
-	propagationPolicy := metav1.DeletePropagationBackground
-	dele := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
-	deleteErr := clientset.CoreV1().Pods(namespace).Delete(ctx, podName, dele)
-	if deleteErr != nil {
-		log.Infof("Pod deleted failed,instanceName:%s,err:%v", podName, deleteErr)
-		return deleteErr
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	err = c.deleteAppPod(ctx, namespace, podName, dele)
+	if err != nil {
+		return err
+	}
+	timeout := podDeleteTimeout
+	if dele.GracePeriodSeconds == nil && pod.Spec.TerminationGracePeriodSeconds != nil {
+		timeout += time.Duration(*pod.Spec.TerminationGracePeriodSeconds) * time.Second
+	}
+	go c.releaseAfterDeleted(namespace, podName, timeout)
+
+	appName := pod.Labels["app"]
+	if len(appName) > 0 {
+		pdbErr := c.resyncAppDisruptionBudget(ctx, namespace, appName)
+		if pdbErr != nil {
+			log.Errorf("PodDisruptionBudget sync failed,app:%s,err:%v", appName, pdbErr)
+		}
 	}
-	log.Infof("Pod deleted successfully,instanceName:%s", podName)
 	return nil
 }
 
-func (c *Conf) ForceDeleteAppPod(ctx context.Context, namespace, podName string) error {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+// releaseAfterDeleted 宽限期和 preStop 期间旧 pod 仍占用 IP, 等 pod 彻底删除后才能释放给其他实例.
+// 超时后保留实例名和 IP, 避免分配给新实例时与仍在运行的旧 pod 冲突
+func (c *Conf) releaseAfterDeleted(namespace, podName string, timeout time.Duration) {
+	err := c.WaitAppPodDeleted(context.Background(), namespace, podName, timeout)
+	if err != nil {
+		log.Errorf("Pod not deleted in time, instance and ip kept,namespace:%s,instanceName:%s,err:%v", namespace, podName, err)
+		return
+	}
+	c.releasePodIP(namespace, podName)
+	c.releaseInstance(podName)
+}
+
+// deleteAppPod 只删除 pod, 不释放固定 IP, 用于原地重建实例
+func (c *Conf) deleteAppPod(ctx context.Context, namespace, podName string, dele metav1.DeleteOptions) error {
+	clientset, err := c.clientset()
 	if err != nil {
 		return err
 	}
-	propagationPolicy := metav1.DeletePropagationBackground
-	var time *int64
-	dele := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy, GracePeriodSeconds: time}
 	deleteErr := clientset.CoreV1().Pods(namespace).Delete(ctx, podName, dele)
 	if deleteErr != nil {
 		log.Infof("Pod deleted failed,instanceName:%s,err:%v", podName, deleteErr)
@@ -198,19 +346,34 @@ func NewKubernetesConf(env, k8sApiServer, k8sBearerToken string) *Conf {
 	}
 
 	c := &Conf{
-		Env:      env,
-		RestConf: r,
+		K8sApiServer: k8sApiServer,
+		Env:          env,
+		RestConf:     r,
 	}
 	return c
 }
 
-func (c *Conf) createPod(template *AppPodTemplate) *v1.Pod {
+// NewKubernetesConfFromEnv 按 CMDB 中的环境配置创建 Conf, DockerYard 非空时创建 namespace 会同时创建镜像 pull secret
+func NewKubernetesConfFromEnv(env *remote.ENV, k8sApiServer, k8sBearerToken string) (*Conf, error) {
+	c := NewKubernetesConf(env.Name, k8sApiServer, k8sBearerToken)
+	if len(env.DockerYard) > 0 {
+		registry, err := ParseDockerYard(env.DockerYard)
+		if err != nil {
+			return nil, fmt.Errorf("invalid docker yard of env %s: %w", env.Name, err)
+		}
+		c.Registry = registry
+	}
+	return c, nil
+}
+
+func (c *Conf) createPod(template *AppPodTemplate) (*v1.Pod, error) {
 	pod := &v1.Pod{}
 	pod.APIVersion = "v1"
 	pod.Kind = "Pod"
 
 	objectMeta := metav1.ObjectMeta{}
 	objectMeta.Name = template.PodName
+	objectMeta.Namespace = template.Namespace
 
 	labels := make(map[string]string)
 	labels["app"] = template.AppName
@@ -219,10 +382,26 @@ func (c *Conf) createPod(template *AppPodTemplate) *v1.Pod {
 	labels["ip"] = template.PodIP
 
 	objectMeta.Labels = labels
+
+	annotations := make(map[string]string)
+	if version := appConfigsVersion(template.Configs); len(version) > 0 {
+		annotations[ConfigVersionAnnotation] = version
+	}
+	if len(template.PodIP) > 0 && c.PodIPAnnotator != nil {
+		for k, v := range c.PodIPAnnotator(template.PodIP) {
+			annotations[k] = v
+		}
+	}
+	if len(annotations) > 0 {
+		objectMeta.Annotations = annotations
+	}
 	pod.ObjectMeta = objectMeta
 
 	podSpec := v1.PodSpec{}
-	podSpec.Hostname = strings.ReplaceAll(template.PodName, "\\.", "")
+	podSpec.Hostname = formatHostname(template.PodName)
+	if len(template.Hostname) > 0 {
+		podSpec.Hostname = template.Hostname
+	}
 	podSpec.PriorityClassName = template.K8sQuota.GetScope()
 
 	if len(template.Dns) == 0 {
@@ -234,15 +413,27 @@ func (c *Conf) createPod(template *AppPodTemplate) *v1.Pod {
 		podSpec.DNSConfig = dnsConfig
 	}
 
-	podSpec.Volumes = createVolumes()
+	podSpec.Volumes = createConfigVolumes(template.Configs, template.AppName)
 
-	reference := v1.LocalObjectReference{Name: "dockeryardkey"}
+	pullSecret := template.ImagePullSecret
+	if len(pullSecret) == 0 {
+		pullSecret = ImagePullSecretName
+	}
+	reference := v1.LocalObjectReference{Name: pullSecret}
 	podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, reference)
 
+	mainContainer := c.createContainer(template)
+	applyShutdown(template, &podSpec, &mainContainer)
+	applyDataVolume(template, &podSpec, &mainContainer)
+
 	var containers []v1.Container
-	containers = append(containers, c.createContainer(template))
+	containers = append(containers, mainContainer)
 
 	podSpec.Containers = containers
+	err := applySidecars(template, &podSpec, &podSpec.Containers[0])
+	if err != nil {
+		return nil, err
+	}
 	podSpec.RestartPolicy = "Always"
 
 	var v1Sysctls []v1.Sysctl
@@ -261,79 +452,19 @@ func (c *Conf) createPod(template *AppPodTemplate) *v1.Pod {
 	securityContext.Sysctls = v1Sysctls
 	podSpec.SecurityContext = securityContext
 
-	var hostAliases []v1.HostAlias
-	v1HostAlias := v1.HostAlias{}
-	v1HostAlias.IP = "127.0.0.1"
-	var hostNames1 []string
-	hostNames1 = append(hostNames1, "localhost.localdomain", "localhost4", "localhost4.localdomain4")
-	v1HostAlias.Hostnames = hostNames1
-	hostAliases = append(hostAliases, v1HostAlias)
-
-	var hostNames2 []string
-	hostNames1 = append(hostNames2, "localhost.localdomain", "localhost6", "localhost6.localdomain6")
-	v1HostAlias.Hostnames = hostNames2
-	hostAliases = append(hostAliases, v1HostAlias)
-
-	podSpec.HostAliases = hostAliases
+	applyScheduling(template, &podSpec)
 
 	pod.Spec = podSpec
 
-	return pod
-}
-
-func createVolumes() []v1.Volume {
-	var v1Volumes []v1.Volume
-
-	v1Volume := v1.Volume{}
-	v1Volume.Name = "cpuinfo"
-	v1HostPathVolumeSource := &v1.HostPathVolumeSource{}
-	v1HostPathVolumeSource.Path = "/var/lib/lxcfs/proc/cpuinfo"
-	v1Volume.HostPath = v1HostPathVolumeSource
-	v1Volumes = append(v1Volumes, v1Volume)
-
-	v1Volume = v1.Volume{}
-	v1Volume.Name = "diskstats"
-	v1HostPathVolumeSource = &v1.HostPathVolumeSource{}
-	v1HostPathVolumeSource.Path = "/var/lib/lxcfs/proc/diskstats"
-	v1Volume.HostPath = v1HostPathVolumeSource
-	v1Volumes = append(v1Volumes, v1Volume)
-
-	v1Volume = v1.Volume{}
-	v1Volume.Name = "meminfo"
-	v1HostPathVolumeSource = &v1.HostPathVolumeSource{}
-	v1HostPathVolumeSource.Path = "/var/lib/lxcfs/proc/meminfo"
-	v1Volume.HostPath = v1HostPathVolumeSource
-	v1Volumes = append(v1Volumes, v1Volume)
-
-	v1Volume = v1.Volume{}
-	v1Volume.Name = "stat"
-	v1HostPathVolumeSource = &v1.HostPathVolumeSource{}
-	v1HostPathVolumeSource.Path = "/var/lib/lxcfs/proc/stat"
-	v1Volume.HostPath = v1HostPathVolumeSource
-	v1Volumes = append(v1Volumes, v1Volume)
-
-	v1Volume = v1.Volume{}
-	v1Volume.Name = "swaps"
-	v1HostPathVolumeSource = &v1.HostPathVolumeSource{}
-	v1HostPathVolumeSource.Path = "/var/lib/lxcfs/proc/swaps"
-	v1Volume.HostPath = v1HostPathVolumeSource
-	v1Volumes = append(v1Volumes, v1Volume)
-
-	v1Volume = v1.Volume{}
-	v1Volume.Name = "uptime"
-	v1HostPathVolumeSource = &v1.HostPathVolumeSource{}
-	v1HostPathVolumeSource.Path = "/var/lib/lxcfs/proc/uptime"
-	v1Volume.HostPath = v1HostPathVolumeSource
-	v1Volumes = append(v1Volumes, v1Volume)
-
-	v1Volume = v1.Volume{}
-	v1Volume.Name = "localtime"
-	v1HostPathVolumeSource = &v1.HostPathVolumeSource{}
-	v1HostPathVolumeSource.Path = "/usr/share/zoneinfo/Asia/Shanghai"
-	v1Volume.HostPath = v1HostPathVolumeSource
-	v1Volumes = append(v1Volumes, v1Volume)
-
-	return v1Volumes
+	chain, err := c.podMutatorChain()
+	if err != nil {
+		return nil, err
+	}
+	err = chain.Mutate(c, template, pod)
+	if err != nil {
+		return nil, err
+	}
+	return pod, nil
 }
 
 func (c *Conf) createContainer(template *AppPodTemplate) v1.Container {
@@ -358,29 +489,10 @@ func (c *Conf) createContainer(template *AppPodTemplate) v1.Container {
 
 	envVar = v1.EnvVar{}
 	envVar.Name = "ENV"
-	if strings.HasPrefix(c.Env, "fat") || strings.HasPrefix(c.Env, "lpt") {
-		envVar.Value = "fat"
-	} else if strings.HasPrefix(c.Env, "uat") {
-		envVar.Value = "uat"
-	} else {
-		envVar.Value = c.Env
-	}
-	envs = append(envs, envVar)
-
-	envVar = v1.EnvVar{}
-	envVar.Name = "TZ"
-	envVar.Value = "Asia/Shanghai"
-	envs = append(envs, envVar)
-
-	envVar = v1.EnvVar{}
-	envVar.Name = "LANG"
-	envVar.Value = "en_US.UTF-8"
+	envVar.Value = c.Env
 	envs = append(envs, envVar)
 
-	envVar = v1.EnvVar{}
-	envVar.Name = "LC_ALL"
-	envVar.Value = "en_US.UTF-8"
-	envs = append(envs, envVar)
+	envs = append(envs, createSecretEnvs(template.SecretEnvs)...)
 
 	// todo 不知道具体格式
 	//envVars := template.EnvJson
@@ -397,6 +509,7 @@ func (c *Conf) createContainer(template *AppPodTemplate) v1.Container {
 	}
 
 	v1Container.Env = envs
+	v1Container.EnvFrom = createConfigEnvFrom(template.Configs, template.AppName)
 
 	requirements := v1.ResourceRequirements{}
 	if strings.EqualFold(c.Env, "pro") {
@@ -430,15 +543,28 @@ func (c *Conf) createContainer(template *AppPodTemplate) v1.Container {
 	v1Container.Image = template.Image
 	v1Container.ImagePullPolicy = "IfNotPresent"
 	v1Container.Name = formatContainerName(template.AppName)
-	v1Container.VolumeMounts = createVolumeMounts()
+	v1Container.VolumeMounts = createConfigVolumeMounts(template.Configs)
 
 	v1Container.ReadinessProbe = createReadinessProbe(newProbe())
 
 	return v1Container
 }
 
+func formatHostname(podName string) string {
+	hostname := strings.ReplaceAll(podName, ".", "")
+	if len(hostname) > validation.DNS1123LabelMaxLength {
+		hostname = strings.TrimRight(hostname[:validation.DNS1123LabelMaxLength], "-")
+	}
+	return hostname
+}
+
+// AppContainerName 返回应用容器在 pod 中的名字
+func AppContainerName(appName string) string {
+	return formatContainerName(appName)
+}
+
 func formatContainerName(containerName string) string {
-	return strings.ReplaceAll(containerName, "\\.", "-")
+	return strings.ToLower(strings.ReplaceAll(containerName, ".", "-"))
 }
 
 func createReadinessProbe(probe PodHttpReadinessProbe) *v1.Probe {
@@ -459,102 +585,41 @@ func createReadinessProbe(probe PodHttpReadinessProbe) *v1.Probe {
 	return v1Probe
 }
 
-func createVolumeMounts() []v1.VolumeMount {
-	var volumeMounts []v1.VolumeMount
-
-	v1VolumeMount := v1.VolumeMount{}
-	v1VolumeMount.Name = "cpuinfo"
-	v1VolumeMount.MountPath = "/proc/cpuinfo"
-	volumeMounts = append(volumeMounts, v1VolumeMount)
-
-	v1VolumeMount = v1.VolumeMount{}
-	v1VolumeMount.Name = "diskstats"
-	v1VolumeMount.MountPath = "/proc/diskstats"
-	volumeMounts = append(volumeMounts, v1VolumeMount)
-
-	v1VolumeMount = v1.VolumeMount{}
-	v1VolumeMount.Name = "meminfo"
-	v1VolumeMount.MountPath = "/proc/meminfo"
-	volumeMounts = append(volumeMounts, v1VolumeMount)
-
-	v1VolumeMount = v1.VolumeMount{}
-	v1VolumeMount.Name = "stat"
-	v1VolumeMount.MountPath = "/proc/stat"
-	volumeMounts = append(volumeMounts, v1VolumeMount)
-
-	v1VolumeMount = v1.VolumeMount{}
-	v1VolumeMount.Name = "swaps"
-	v1VolumeMount.MountPath = "/proc/swaps"
-	volumeMounts = append(volumeMounts, v1VolumeMount)
-
-	v1VolumeMount = v1.VolumeMount{}
-	v1VolumeMount.Name = "uptime"
-	v1VolumeMount.MountPath = "/proc/uptime"
-	volumeMounts = append(volumeMounts, v1VolumeMount)
-
-	v1VolumeMount = v1.VolumeMount{}
-	v1VolumeMount.Name = "localtime"
-	v1VolumeMount.MountPath = "/etc/localtime"
-	volumeMounts = append(volumeMounts, v1VolumeMount)
-
-	return volumeMounts
-}
-
-func (c *Conf) CreateNamespace(ctx context.Context, namespace string) error {
-
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
-	if err != nil {
-		return err
-	}
-
-	nsName := &v1.Namespace{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: namespace,
-		},
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: "v1",
-			Kind:       "Namespace",
-		},
-	}
-
-	_, err = clientset.CoreV1().Namespaces().Create(ctx, nsName, metav1.CreateOptions{})
+func (c *Conf) CreateNamespace(ctx context.Context, namespace string) (err error) {
+	defer c.wrapError(&err, "CreateNamespace", namespace, "")
+	_, err = c.CreateOrUpdateNamespace(ctx, namespace, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	return c.provisionPullSecret(ctx, namespace)
 }
 
-func (c *Conf) CreateConfigMap(ctx context.Context, namespace string, configName string, dataMap map[string]string) error {
-
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
-	if err != nil {
-		return err
-	}
-
-	body := &v1.ConfigMap{}
-	body.APIVersion = "v1"
-	body.Data = dataMap
-
-	objectMeta := metav1.ObjectMeta{Name: configName}
-	body.ObjectMeta = objectMeta
-
-	_, err = clientset.CoreV1().ConfigMaps(namespace).Create(ctx, body, metav1.CreateOptions{})
-	if err != nil {
+func (c *Conf) provisionPullSecret(ctx context.Context, namespace string) error {
+	if c.Registry == nil {
 		return nil
 	}
-	return nil
+	_, err := c.ApplyRegistrySecret(ctx, namespace, c.Registry)
+	return err
+}
+
+func (c *Conf) CreateConfigMap(ctx context.Context, namespace string, configName string, dataMap map[string]string) (err error) {
+	defer c.wrapError(&err, "CreateConfigMap", namespace, "")
+	_, err = c.CreateOrUpdateConfigMap(ctx, namespace, configName, dataMap)
+	return err
 }
 
-func (c *Conf) GetConfigMap(ctx context.Context, namespace string, configName string) (*v1.ConfigMap, error) {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) GetConfigMap(ctx context.Context, namespace string, configName string) (_ *v1.ConfigMap, err error) {
+	defer c.wrapError(&err, "GetConfigMap", namespace, "")
+	clientset, err := c.clientset()
 	if err != nil {
 		return nil, err
 	}
 	return clientset.CoreV1().ConfigMaps(namespace).Get(ctx, configName, metav1.GetOptions{})
 }
 
-func (c *Conf) DeleteConfigMap(ctx context.Context, namespace string, configName string) error {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) DeleteConfigMap(ctx context.Context, namespace string, configName string) (err error) {
+	defer c.wrapError(&err, "DeleteConfigMap", namespace, "")
+	clientset, err := c.clientset()
 	if err != nil {
 		return err
 	}
@@ -568,8 +633,19 @@ func (c *Conf) DeleteConfigMap(ctx context.Context, namespace string, configName
 	return nil
 }
 
-func (c *Conf) ExecCommand(ctx context.Context, pod string, namespace string, commands []string) (string, string, error) {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) ExecCommand(ctx context.Context, pod string, namespace string, commands []string) (_ string, _ string, err error) {
+	defer c.wrapError(&err, "ExecCommand", namespace, "")
+	return c.ExecCommandInContainer(ctx, pod, namespace, "", commands)
+}
+
+// ExecCommandInContainer 在指定容器中执行命令, containerName 为空时使用应用容器
+func (c *Conf) ExecCommandInContainer(ctx context.Context, pod string, namespace string, containerName string, commands []string) (_ string, _ string, err error) {
+	defer c.wrapError(&err, "ExecCommandInContainer", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return "", "", err
+	}
+	containerName, err = c.resolveContainerName(ctx, namespace, pod, containerName)
 	if err != nil {
 		return "", "", err
 	}
@@ -582,14 +658,18 @@ func (c *Conf) ExecCommand(ctx context.Context, pod string, namespace string, co
 		Name(pod).
 		SubResource("exec").
 		VersionedParams(&v1.PodExecOptions{
-			Command: commands,
-			Stdin:   false,
-			Stdout:  true,
-			Stderr:  true,
-			TTY:     true,
+			Container: containerName,
+			Command:   commands,
+			Stdin:     false,
+			Stdout:    true,
+			Stderr:    true,
+			TTY:       true,
 		}, scheme.ParameterCodec)
-	exec, err := remotecommand.NewSPDYExecutor(c.RestConf, "POST", req.URL())
-	err = exec.Stream(remotecommand.StreamOptions{
+	exec, err := remotecommand.NewSPDYExecutor(c.restConfig(), "POST", req.URL())
+	if err != nil {
+		return "", "", err
+	}
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
 		Stdout: buf,
 		Stderr: errBuf,
 	})
@@ -599,8 +679,9 @@ func (c *Conf) ExecCommand(ctx context.Context, pod string, namespace string, co
 	return buf.String(), errBuf.String(), nil
 }
 
-func (c *Conf) GetNodeByIP(ctx context.Context, hostIP string) (*v1.Node, error) {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) GetNodeByIP(ctx context.Context, hostIP string) (_ *v1.Node, err error) {
+	defer c.wrapError(&err, "GetNodeByIP", "", "")
+	clientset, err := c.clientset()
 	if err != nil {
 		return nil, err
 	}
@@ -612,18 +693,30 @@ func (c *Conf) GetNodeByIP(ctx context.Context, hostIP string) (*v1.Node, error)
 	if err != nil {
 		return nil, err
 	}
-	if len(nodeList.Items) > 0 {
-		return &nodeList.Items[0], nil
+	if len(nodeList.Items) == 0 {
+		return nil, errs.New(errs.NotFound, "GetNodeByIP", fmt.Errorf("node %s not found", hostIP))
 	}
-	return nil, nil
+	return &nodeList.Items[0], nil
+}
+
+func (c *Conf) GetAppPodLog(ctx context.Context, namespace, instanceName string) (_ string, err error) {
+	defer c.wrapError(&err, "GetAppPodLog", namespace, "")
+	return c.GetAppPodContainerLog(ctx, namespace, instanceName, "")
 }
 
-func (c *Conf) GetAppPodLog(ctx context.Context, namespace, instanceName string) (string, error) {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+// GetAppPodContainerLog 读取指定容器最近的日志, containerName 为空时使用应用容器
+func (c *Conf) GetAppPodContainerLog(ctx context.Context, namespace, instanceName, containerName string) (_ string, err error) {
+	defer c.wrapError(&err, "GetAppPodContainerLog", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return "", err
+	}
+	containerName, err = c.resolveContainerName(ctx, namespace, instanceName, containerName)
 	if err != nil {
 		return "", err
 	}
 	opts := &v1.PodLogOptions{}
+	opts.Container = containerName
 	opts.Follow = false
 	limitBytes := int64(1 * 1024 * 1024)
 	opts.LimitBytes = &limitBytes
@@ -640,22 +733,19 @@ func (c *Conf) GetAppPodLog(ctx context.Context, namespace, instanceName string)
 	defer stream.Close()
 
 	// Read log output
-	buf := make([]byte, 1024)
-	for {
-		n, err := stream.Read(buf)
-		if err != nil {
-			if err != io.EOF {
-				panic(err)
-			}
-			break
-		}
-		return string(buf[:n]), nil
+	logs, err := io.ReadAll(stream)
+	if err != nil {
+		return "", err
 	}
-	return "", nil
+	return string(logs), nil
 }
 
-func (c *Conf) CreateService(ctx context.Context, appName, namespace string) error {
-	clientset, err := kubernetes.NewForConfig(c.RestConf)
+func (c *Conf) CreateService(ctx context.Context, appName, namespace string) (err error) {
+	defer c.wrapError(&err, "CreateService", namespace, appName)
+	if len(appName) == 0 {
+		return fmt.Errorf("app name is required to create service")
+	}
+	clientset, err := c.clientset()
 	if err != nil {
 		return err
 	}
@@ -674,8 +764,8 @@ func (c *Conf) CreateService(ctx context.Context, appName, namespace string) err
 
 	port := v1.ServicePort{}
 	port.Protocol = v1.ProtocolTCP
-	port.Port = 8080
-	port.TargetPort = intstr.FromInt(8080)
+	port.Port = appServicePort
+	port.TargetPort = intstr.FromInt(appServicePort)
 	spec.Ports = []v1.ServicePort{port}
 
 	service.Spec = spec
@@ -689,7 +779,7 @@ func (c *Conf) CreateService(ctx context.Context, appName, namespace string) err
 
 func getServiceFromAppName(appName string) string {
 	service := strings.ReplaceAll(appName, ".", "-")
-	if unicode.IsDigit(rune(appName[0])) {
+	if len(appName) > 0 && unicode.IsDigit(rune(appName[0])) {
 		return "s" + service
 	}
 	return service
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"strconv"
+	"strings"
+)
+
+// Shutdown 应用实例的优雅下线配置, 删除 pod 时先执行 preStop 让应用从注册中心摘除, 再发送 SIGTERM
+type Shutdown struct {
+	// 为 0 时使用 k8s 默认的 30 秒
+	GracePeriodSeconds int64
+
+	// 非空时 preStop 调用应用端口上的该 HTTP 接口下线
+	PreStopPath string
+
+	// 没有 PreStopPath 时 preStop 执行 sleep, 给注册中心和负载均衡摘除流量的时间
+	PreStopSleepSeconds int64
+}
+
+func applyShutdown(template *AppPodTemplate, podSpec *v1.PodSpec, container *v1.Container) {
+	shutdown := template.Shutdown
+	if shutdown.GracePeriodSeconds > 0 {
+		gracePeriod := shutdown.GracePeriodSeconds
+		podSpec.TerminationGracePeriodSeconds = &gracePeriod
+	}
+
+	handler := &v1.LifecycleHandler{}
+	if len(shutdown.PreStopPath) > 0 {
+		port := int(template.Port)
+		if port == 0 {
+			port = newProbe().port
+		}
+		handler.HTTPGet = &v1.HTTPGetAction{
+			Path: shutdown.PreStopPath,
+			Port: intstr.FromInt(port),
+		}
+	} else if shutdown.PreStopSleepSeconds > 0 {
+		handler.Exec = &v1.ExecAction{
+			Command: []string{"sleep", strconv.FormatInt(shutdown.PreStopSleepSeconds, 10)},
+		}
+	} else {
+		return
+	}
+	container.Lifecycle = &v1.Lifecycle{PreStop: handler}
+}
+
+func validateShutdown(shutdown Shutdown, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if shutdown.GracePeriodSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("GracePeriodSeconds"), shutdown.GracePeriodSeconds, "must be non-negative"))
+	}
+	if shutdown.PreStopSleepSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("PreStopSleepSeconds"), shutdown.PreStopSleepSeconds, "must be non-negative"))
+	}
+	if len(shutdown.PreStopPath) > 0 && !strings.HasPrefix(shutdown.PreStopPath, "/") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("PreStopPath"), shutdown.PreStopPath, "must be an absolute path"))
+	}
+	gracePeriod := shutdown.GracePeriodSeconds
+	if gracePeriod == 0 {
+		gracePeriod = v1.DefaultTerminationGracePeriodSeconds
+	}
+	if len(shutdown.PreStopPath) == 0 && shutdown.PreStopSleepSeconds >= gracePeriod {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("PreStopSleepSeconds"), shutdown.PreStopSleepSeconds,
+			"must be less than the termination grace period "+strconv.FormatInt(gracePeriod, 10)))
+	}
+	return allErrs
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// 安装了 lxcfs 的节点打上该 label, 依赖 lxcfs 的 pod 只会调度到这些节点
+	LxcfsNodeLabel = "lxcfs"
+	LxcfsNodeValue = "true"
+
+	lxcfsProcDir = "/var/lib/lxcfs/proc/"
+)
+
+var lxcfsProcFiles = []string{"cpuinfo", "diskstats", "meminfo", "stat", "swaps", "uptime"}
+
+func createLxcfsVolumes() []v1.Volume {
+	var v1Volumes []v1.Volume
+	hostPathType := v1.HostPathFile
+	for _, name := range lxcfsProcFiles {
+		v1Volume := v1.Volume{}
+		v1Volume.Name = name
+		v1HostPathVolumeSource := &v1.HostPathVolumeSource{}
+		v1HostPathVolumeSource.Path = lxcfsProcDir + name
+		// 节点上没有该文件时直接失败, 而不是创建一个空目录挂进去
+		v1HostPathVolumeSource.Type = &hostPathType
+		v1Volume.HostPath = v1HostPathVolumeSource
+		v1Volumes = append(v1Volumes, v1Volume)
+	}
+	return v1Volumes
+}
+
+func createLxcfsVolumeMounts() []v1.VolumeMount {
+	var volumeMounts []v1.VolumeMount
+	for _, name := range lxcfsProcFiles {
+		v1VolumeMount := v1.VolumeMount{}
+		v1VolumeMount.Name = name
+		v1VolumeMount.MountPath = "/proc/" + name
+		volumeMounts = append(volumeMounts, v1VolumeMount)
+	}
+	return volumeMounts
+}
+
+// mutateLxcfs 用 lxcfs 的 /proc 文件覆盖容器内的 /proc, 让容器内看到的是自己的资源限制.
+// 不需要 lxcfs 的机房在 MutatorPolicy.Zone 中去掉该 mutator 即可
+func mutateLxcfs(c *Conf, template *AppPodTemplate, pod *v1.Pod) error {
+	container := appContainer(template, pod)
+	if container == nil {
+		return fmt.Errorf("app container not found")
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, createLxcfsVolumes()...)
+	container.VolumeMounts = append(container.VolumeMounts, createLxcfsVolumeMounts()...)
+	return nil
+}
+
+// mutateLxcfsAffinity 限制 pod 只调度到带 LxcfsNodeLabel 的节点. 现有节点都没有该 label, 因此不在默认策略中,
+// 机房的所有 lxcfs 节点通过 SetNodeLxcfs 打上 label 后, 再在 MutatorPolicy.Zone 中启用
+func mutateLxcfsAffinity(c *Conf, template *AppPodTemplate, pod *v1.Pod) error {
+	requirement := v1.NodeSelectorRequirement{
+		Key:      LxcfsNodeLabel,
+		Operator: v1.NodeSelectorOpIn,
+		Values:   []string{LxcfsNodeValue},
+	}
+	addRequiredNodeSelectorRequirement(pod, requirement)
+	return nil
+}
+
+// addRequiredNodeSelectorRequirement 把条件追加到每个 required NodeSelectorTerm 中, 即与已有条件取 AND
+func addRequiredNodeSelectorRequirement(pod *v1.Pod, requirement v1.NodeSelectorRequirement) {
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &v1.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &v1.NodeAffinity{}
+	}
+	nodeAffinity := pod.Spec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{}
+	}
+	selector := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []v1.NodeSelectorTerm{{}}
+	}
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		term.MatchExpressions = append(term.MatchExpressions, requirement)
+	}
+}
+
+// NodeSupportsLxcfs 检查节点是否声明了 lxcfs 能力
+func (c *Conf) NodeSupportsLxcfs(ctx context.Context, hostIP string) (_ bool, err error) {
+	defer c.wrapError(&err, "NodeSupportsLxcfs", "", "")
+	node, err := c.GetNodeByIP(ctx, hostIP)
+	if err != nil {
+		return false, err
+	}
+	return node.Labels[LxcfsNodeLabel] == LxcfsNodeValue, nil
+}
+
+// SetNodeLxcfs 在节点安装或卸载 lxcfs 后更新节点的 lxcfs label
+func (c *Conf) SetNodeLxcfs(ctx context.Context, hostIP string, enabled bool) (err error) {
+	defer c.wrapError(&err, "SetNodeLxcfs", "", "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, getErr := c.GetNodeByIP(ctx, hostIP)
+		if getErr != nil {
+			return getErr
+		}
+		if node.Labels == nil {
+			node.Labels = make(map[string]string)
+		}
+		if enabled {
+			node.Labels[LxcfsNodeLabel] = LxcfsNodeValue
+		} else {
+			delete(node.Labels, LxcfsNodeLabel)
+		}
+		_, updateErr := clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return updateErr
+	})
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"fmt"
+	"k8s.io/api/core/v1"
+	"strings"
+	"sync"
+)
+
+const (
+	MutatorLxcfs         = "lxcfs"
+	MutatorLxcfsAffinity = "lxcfs-affinity"
+	MutatorTimezone      = "timezone"
+	MutatorHostAliases   = "host-aliases"
+	MutatorEnvAlias      = "env-alias"
+)
+
+// PodMutator 对 createPod 生成的基础 pod 追加环境相关的策略, 例如挂载、sidecar、tolerations
+type PodMutator interface {
+	Name() string
+
+	Mutate(c *Conf, template *AppPodTemplate, pod *v1.Pod) error
+}
+
+type podMutatorFunc struct {
+	name string
+	fn   func(c *Conf, template *AppPodTemplate, pod *v1.Pod) error
+}
+
+func (m *podMutatorFunc) Name() string {
+	return m.name
+}
+
+func (m *podMutatorFunc) Mutate(c *Conf, template *AppPodTemplate, pod *v1.Pod) error {
+	return m.fn(c, template, pod)
+}
+
+func NewPodMutator(name string, fn func(c *Conf, template *AppPodTemplate, pod *v1.Pod) error) PodMutator {
+	return &podMutatorFunc{name: name, fn: fn}
+}
+
+var (
+	podMutatorsLock sync.RWMutex
+	podMutators     = make(map[string]PodMutator)
+)
+
+// RegisterPodMutator 注册一个 mutator, 同名覆盖, 需要在 MutatorPolicy 中按名字启用
+func RegisterPodMutator(m PodMutator) {
+	podMutatorsLock.Lock()
+	defer podMutatorsLock.Unlock()
+	podMutators[m.Name()] = m
+}
+
+func getPodMutator(name string) (PodMutator, bool) {
+	podMutatorsLock.RLock()
+	defer podMutatorsLock.RUnlock()
+	m, ok := podMutators[name]
+	return m, ok
+}
+
+// MutatorPolicy 决定每个环境/机房启用哪些 mutator 以及执行顺序, Zone 优先于 Env, 都没有配置时使用 Default
+type MutatorPolicy struct {
+	Default []string
+	Env     map[string][]string
+	Zone    map[string][]string
+}
+
+func DefaultMutatorPolicy() *MutatorPolicy {
+	return &MutatorPolicy{
+		Default: []string{MutatorEnvAlias, MutatorLxcfs, MutatorTimezone, MutatorHostAliases},
+	}
+}
+
+func (p *MutatorPolicy) resolve(env, zone string) []string {
+	if names, ok := p.Zone[zone]; ok && len(zone) > 0 {
+		return names
+	}
+	if names, ok := p.Env[env]; ok && len(env) > 0 {
+		return names
+	}
+	return p.Default
+}
+
+type MutatorChain []PodMutator
+
+func (chain MutatorChain) Mutate(c *Conf, template *AppPodTemplate, pod *v1.Pod) error {
+	for _, m := range chain {
+		err := m.Mutate(c, template, pod)
+		if err != nil {
+			return fmt.Errorf("pod mutator %s: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (c *Conf) podMutatorChain() (MutatorChain, error) {
+	policy := c.MutatorPolicy
+	if policy == nil {
+		policy = DefaultMutatorPolicy()
+	}
+	var chain MutatorChain
+	for _, name := range policy.resolve(c.Env, c.Zone) {
+		m, ok := getPodMutator(name)
+		if !ok {
+			return nil, fmt.Errorf("pod mutator %s not registered", name)
+		}
+		chain = append(chain, m)
+	}
+	return chain, nil
+}
+
+// appContainer 返回 pod 中的应用容器
+func appContainer(template *AppPodTemplate, pod *v1.Pod) *v1.Container {
+	name := formatContainerName(template.AppName)
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == name {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+func setEnv(container *v1.Container, name, value string) {
+	for i := range container.Env {
+		if container.Env[i].Name == name {
+			container.Env[i].Value = value
+			container.Env[i].ValueFrom = nil
+			return
+		}
+	}
+	container.Env = append(container.Env, v1.EnvVar{Name: name, Value: value})
+}
+
+func init() {
+	RegisterPodMutator(NewPodMutator(MutatorLxcfs, mutateLxcfs))
+	RegisterPodMutator(NewPodMutator(MutatorLxcfsAffinity, mutateLxcfsAffinity))
+	RegisterPodMutator(NewPodMutator(MutatorTimezone, mutateTimezone))
+	RegisterPodMutator(NewPodMutator(MutatorHostAliases, mutateHostAliases))
+	RegisterPodMutator(NewPodMutator(MutatorEnvAlias, mutateEnvAlias))
+}
+
+// mutateTimezone 挂载节点上的 zoneinfo 文件作为 /etc/localtime, 并设置一致的 TZ/LANG/LC_ALL
+func mutateTimezone(c *Conf, template *AppPodTemplate, pod *v1.Pod) error {
+	container := appContainer(template, pod)
+	if container == nil {
+		return fmt.Errorf("app container not found")
+	}
+
+	tz := c.resolveTimezone(template)
+	if err := ValidateTimezone(tz); err != nil {
+		return err
+	}
+	locale := c.resolveLocale(template)
+	if err := ValidateLocale(locale); err != nil {
+		return err
+	}
+
+	v1Volume := v1.Volume{}
+	v1Volume.Name = localtimeVolumeName
+	v1HostPathVolumeSource := &v1.HostPathVolumeSource{}
+	v1HostPathVolumeSource.Path = zoneinfoDir + tz
+	// ValidateTimezone 按 Go 内置的 tzdata 校验, 节点上没有该 zoneinfo 文件时直接失败, 而不是挂一个空目录到 /etc/localtime
+	hostPathType := v1.HostPathFile
+	v1HostPathVolumeSource.Type = &hostPathType
+	v1Volume.HostPath = v1HostPathVolumeSource
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1Volume)
+
+	v1VolumeMount := v1.VolumeMount{}
+	v1VolumeMount.Name = localtimeVolumeName
+	v1VolumeMount.MountPath = "/etc/localtime"
+	v1VolumeMount.ReadOnly = true
+	container.VolumeMounts = append(container.VolumeMounts, v1VolumeMount)
+
+	setEnv(container, "TZ", tz)
+	setEnv(container, "LANG", locale)
+	setEnv(container, "LC_ALL", locale)
+	return nil
+}
+
+// mutateEnvAlias 把集群环境名映射为应用识别的 ENV, fat/lpt 开头的都视为 fat, uat 开头的视为 uat
+func mutateEnvAlias(c *Conf, template *AppPodTemplate, pod *v1.Pod) error {
+	container := appContainer(template, pod)
+	if container == nil {
+		return fmt.Errorf("app container not found")
+	}
+	if strings.HasPrefix(c.Env, "fat") || strings.HasPrefix(c.Env, "lpt") {
+		setEnv(container, "ENV", "fat")
+	} else if strings.HasPrefix(c.Env, "uat") {
+		setEnv(container, "ENV", "uat")
+	}
+	return nil
+}
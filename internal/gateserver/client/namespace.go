@@ -0,0 +1,209 @@
+package client
+
+import (
+	"cicd_go/internal/atlas/model"
+	"cicd_go/internal/gateserver/remote"
+	"context"
+	"fmt"
+	"github.com/google/martian/log"
+	"k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+)
+
+const (
+	NamespaceLabelOrgID   = "org-id"
+	NamespaceLabelOrgCode = "org-code"
+	NamespaceLabelEnv     = "env"
+
+	namespaceQuotaName      = "org-quota"
+	namespaceLimitRangeName = "org-limits"
+)
+
+// NamespaceQuota 组织在某个环境下的资源汇总, 由 CMDB 中的 AppQuota 聚合而来
+type NamespaceQuota struct {
+	OrgID   int64
+	OrgCode string
+	Env     string
+
+	// 所有实例的 CPU/内存 总和
+	CPU    resource.Quantity
+	Memory resource.Quantity
+	Pods   int64
+
+	// 单个容器允许的最大/默认规格
+	MaxCPU        resource.Quantity
+	MaxMemory     resource.Quantity
+	DefaultCPU    resource.Quantity
+	DefaultMemory resource.Quantity
+}
+
+// AggregateNamespaceQuota 按规格汇总组织在 env 环境下的 AppQuota, InstanceSpec 中 CPU 单位为核, Memory 单位为 GiB.
+// 没有有效配额时返回错误, 否则 pods: 0 的 ResourceQuota 会让 namespace 无法创建任何 pod
+func AggregateNamespaceQuota(org *model.Organization, env string, quotas []model.AppQuota, specs []*remote.InstanceSpec) (*NamespaceQuota, error) {
+	specMap := make(map[int64]*remote.InstanceSpec)
+	for _, spec := range specs {
+		specMap[spec.ID] = spec
+	}
+
+	nq := &NamespaceQuota{
+		OrgID:   org.ID,
+		OrgCode: org.OrgCode,
+		Env:     env,
+	}
+
+	var totalMilliCPU, totalMemMi int64
+	var maxMilliCPU, maxMemMi, minMilliCPU, minMemMi int64
+	for _, quota := range quotas {
+		if quota.OrgID != org.ID || quota.EnvName != env || !quota.IsActive || quota.Number <= 0 {
+			continue
+		}
+		spec, ok := specMap[quota.SpecTypeID]
+		if !ok {
+			return nil, fmt.Errorf("instance spec %d of app %s not found", quota.SpecTypeID, quota.AppID)
+		}
+		milliCPU := int64(spec.CPU * 1000)
+		memMi := int64(spec.Memory * 1024)
+
+		totalMilliCPU += milliCPU * quota.Number
+		totalMemMi += memMi * quota.Number
+		nq.Pods += quota.Number
+
+		if milliCPU > maxMilliCPU {
+			maxMilliCPU = milliCPU
+		}
+		if memMi > maxMemMi {
+			maxMemMi = memMi
+		}
+		if minMilliCPU == 0 || milliCPU < minMilliCPU {
+			minMilliCPU = milliCPU
+		}
+		if minMemMi == 0 || memMi < minMemMi {
+			minMemMi = memMi
+		}
+	}
+
+	if nq.Pods == 0 {
+		return nil, fmt.Errorf("org %s has no active app quota in env %s", org.OrgCode, env)
+	}
+
+	nq.CPU = *resource.NewMilliQuantity(totalMilliCPU, resource.DecimalSI)
+	nq.Memory = *resource.NewQuantity(totalMemMi*1024*1024, resource.BinarySI)
+	nq.MaxCPU = *resource.NewMilliQuantity(maxMilliCPU, resource.DecimalSI)
+	nq.MaxMemory = *resource.NewQuantity(maxMemMi*1024*1024, resource.BinarySI)
+	nq.DefaultCPU = *resource.NewMilliQuantity(minMilliCPU, resource.DecimalSI)
+	nq.DefaultMemory = *resource.NewQuantity(minMemMi*1024*1024, resource.BinarySI)
+	return nq, nil
+}
+
+func (q *NamespaceQuota) labels() map[string]string {
+	labels := make(map[string]string)
+	labels[NamespaceLabelOrgID] = strconv.FormatInt(q.OrgID, 10)
+	labels[NamespaceLabelOrgCode] = q.OrgCode
+	labels[NamespaceLabelEnv] = q.Env
+	return labels
+}
+
+func (q *NamespaceQuota) resourceQuota(namespace string) *v1.ResourceQuota {
+	hard := v1.ResourceList{}
+	hard[v1.ResourceRequestsCPU] = q.CPU
+	hard[v1.ResourceRequestsMemory] = q.Memory
+	hard[v1.ResourceLimitsCPU] = q.CPU
+	hard[v1.ResourceLimitsMemory] = q.Memory
+	hard[v1.ResourcePods] = *resource.NewQuantity(q.Pods, resource.DecimalSI)
+
+	rq := &v1.ResourceQuota{}
+	rq.APIVersion = "v1"
+	rq.Kind = "ResourceQuota"
+	rq.ObjectMeta = metav1.ObjectMeta{Name: namespaceQuotaName, Namespace: namespace, Labels: q.labels()}
+	rq.Spec.Hard = hard
+	return rq
+}
+
+func (q *NamespaceQuota) limitRange(namespace string) *v1.LimitRange {
+	item := v1.LimitRangeItem{}
+	item.Type = v1.LimitTypeContainer
+	item.Max = v1.ResourceList{}
+	item.Max[v1.ResourceCPU] = q.MaxCPU
+	item.Max[v1.ResourceMemory] = q.MaxMemory
+	item.Default = v1.ResourceList{}
+	item.Default[v1.ResourceCPU] = q.DefaultCPU
+	item.Default[v1.ResourceMemory] = q.DefaultMemory
+	item.DefaultRequest = v1.ResourceList{}
+	item.DefaultRequest[v1.ResourceCPU] = q.DefaultCPU
+	item.DefaultRequest[v1.ResourceMemory] = q.DefaultMemory
+
+	lr := &v1.LimitRange{}
+	lr.APIVersion = "v1"
+	lr.Kind = "LimitRange"
+	lr.ObjectMeta = metav1.ObjectMeta{Name: namespaceLimitRangeName, Namespace: namespace, Labels: q.labels()}
+	lr.Spec.Limits = []v1.LimitRangeItem{item}
+	return lr
+}
+
+// ProvisionNamespace 创建带组织/环境标签的 namespace, 并创建对应的 ResourceQuota 和 LimitRange
+func (c *Conf) ProvisionNamespace(ctx context.Context, namespace string, quota *NamespaceQuota) (err error) {
+	defer c.wrapError(&err, "ProvisionNamespace", namespace, "")
+	result, err := c.CreateOrUpdateNamespace(ctx, namespace, quota.labels())
+	if err != nil {
+		return err
+	}
+	log.Infof("Namespace provisioned,namespace:%s,org:%s,env:%s,result:%s", namespace, quota.OrgCode, quota.Env, result)
+
+	err = c.provisionPullSecret(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ReconcileNamespaceQuota(ctx, namespace, quota)
+	return err
+}
+
+// ReconcileNamespaceQuota 在 CMDB 配额变化后同步 namespace 的 ResourceQuota 和 LimitRange, 配额没有变化时不更新
+func (c *Conf) ReconcileNamespaceQuota(ctx context.Context, namespace string, quota *NamespaceQuota) (_ ApplyResult, err error) {
+	defer c.wrapError(&err, "ReconcileNamespaceQuota", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+
+	rqResult, err := applyObject[*v1.ResourceQuota](ctx, clientset.CoreV1().ResourceQuotas(namespace), v1.Resource("resourcequotas"), quota.resourceQuota(namespace), func(exist, body *v1.ResourceQuota) (bool, error) {
+		changed := mergeLabels(exist, body.Labels)
+		if !apiequality.Semantic.DeepEqual(exist.Spec.Hard, body.Spec.Hard) {
+			exist.Spec.Hard = body.Spec.Hard
+			changed = true
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+
+	lrResult, err := applyObject[*v1.LimitRange](ctx, clientset.CoreV1().LimitRanges(namespace), v1.Resource("limitranges"), quota.limitRange(namespace), func(exist, body *v1.LimitRange) (bool, error) {
+		changed := mergeLabels(exist, body.Labels)
+		if !apiequality.Semantic.DeepEqual(exist.Spec.Limits, body.Spec.Limits) {
+			exist.Spec.Limits = body.Spec.Limits
+			changed = true
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+
+	nsResult, err := c.CreateOrUpdateNamespace(ctx, namespace, quota.labels())
+	if err != nil {
+		return ApplyUnchanged, err
+	}
+
+	result := ApplyUnchanged
+	for _, r := range []ApplyResult{rqResult, lrResult, nsResult} {
+		if r.Changed() {
+			result = ApplyUpdated
+		}
+	}
+	log.Infof("Namespace quota reconciled,namespace:%s,cpu:%s,memory:%s,pods:%d,result:%s", namespace, quota.CPU.String(), quota.Memory.String(), quota.Pods, result)
+	return result, nil
+}
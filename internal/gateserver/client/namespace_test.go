@@ -0,0 +1,95 @@
+package client
+
+import (
+	"cicd_go/internal/atlas/model"
+	"cicd_go/internal/gateserver/remote"
+	"testing"
+)
+
+func appQuota(orgID int64, env string, specID, number int64, active bool) model.AppQuota {
+	quota := model.AppQuota{AppID: "100", OrgID: orgID, EnvName: env, SpecTypeID: specID, Number: number}
+	quota.IsActive = active
+	return quota
+}
+
+func TestAggregateNamespaceQuota(t *testing.T) {
+	org := &model.Organization{ID: 1, OrgCode: "trade"}
+	specs := []*remote.InstanceSpec{
+		{ID: 1, CPU: 0.5, Memory: 1},
+		{ID: 2, CPU: 2, Memory: 4},
+	}
+	tests := []struct {
+		name       string
+		quotas     []model.AppQuota
+		wantErr    bool
+		wantPods   int64
+		wantCPU    string
+		wantMemory string
+		wantMax    string
+		wantDef    string
+	}{
+		{
+			name:     "sum of env quotas",
+			quotas:   []model.AppQuota{appQuota(1, "fat", 1, 2, true), appQuota(1, "fat", 2, 1, true)},
+			wantPods: 3, wantCPU: "3", wantMemory: "6Gi", wantMax: "2", wantDef: "500m",
+		},
+		{
+			name: "other env ignored",
+			quotas: []model.AppQuota{
+				appQuota(1, "fat", 1, 2, true),
+				appQuota(1, "uat", 2, 10, true),
+				appQuota(1, "pro", 2, 10, true),
+			},
+			wantPods: 2, wantCPU: "1", wantMemory: "2Gi", wantMax: "500m", wantDef: "500m",
+		},
+		{
+			name: "other org, inactive and empty ignored",
+			quotas: []model.AppQuota{
+				appQuota(1, "fat", 1, 1, true),
+				appQuota(2, "fat", 2, 5, true),
+				appQuota(1, "fat", 2, 5, false),
+				appQuota(1, "fat", 2, 0, true),
+			},
+			wantPods: 1, wantCPU: "500m", wantMemory: "1Gi", wantMax: "500m", wantDef: "500m",
+		},
+		{
+			name:    "no active quota",
+			quotas:  []model.AppQuota{appQuota(1, "uat", 1, 2, true), appQuota(1, "fat", 1, 2, false)},
+			wantErr: true,
+		},
+		{
+			name:    "unknown spec",
+			quotas:  []model.AppQuota{appQuota(1, "fat", 9, 1, true)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nq, err := AggregateNamespaceQuota(org, "fat", tt.quotas, specs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AggregateNamespaceQuota error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if nq.Pods != tt.wantPods {
+				t.Errorf("Pods = %d, want %d", nq.Pods, tt.wantPods)
+			}
+			if got := nq.CPU.String(); got != tt.wantCPU {
+				t.Errorf("CPU = %s, want %s", got, tt.wantCPU)
+			}
+			if got := nq.Memory.String(); got != tt.wantMemory {
+				t.Errorf("Memory = %s, want %s", got, tt.wantMemory)
+			}
+			if got := nq.MaxCPU.String(); got != tt.wantMax {
+				t.Errorf("MaxCPU = %s, want %s", got, tt.wantMax)
+			}
+			if got := nq.DefaultCPU.String(); got != tt.wantDef {
+				t.Errorf("DefaultCPU = %s, want %s", got, tt.wantDef)
+			}
+			if nq.Env != "fat" || nq.OrgCode != "trade" {
+				t.Errorf("labels source = %s/%s, want trade/fat", nq.OrgCode, nq.Env)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+)
+
+// NodeInventory 节点的容量信息, Requested 为节点上未结束 pod 的 requests 之和
+type NodeInventory struct {
+	Name          string
+	IP            string
+	Env           string
+	Zone          string
+	Labels        map[string]string
+	Taints        []v1.Taint
+	Conditions    map[v1.NodeConditionType]v1.ConditionStatus
+	Unschedulable bool
+
+	AllocatableCPU    resource.Quantity
+	AllocatableMemory resource.Quantity
+	AllocatablePods   resource.Quantity
+	RequestedCPU      resource.Quantity
+	RequestedMemory   resource.Quantity
+	Pods              int
+}
+
+// CapacitySummary 按环境和机房汇总的容量, Quota 由调用方用 CMDB 中的配额填充, 用来对比实际余量
+type CapacitySummary struct {
+	Env   string
+	Zone  string
+	Nodes int
+
+	AllocatableCPU    resource.Quantity
+	AllocatableMemory resource.Quantity
+	RequestedCPU      resource.Quantity
+	RequestedMemory   resource.Quantity
+	QuotaCPU          resource.Quantity
+	QuotaMemory       resource.Quantity
+}
+
+func (s *CapacitySummary) HeadroomCPU() resource.Quantity {
+	headroom := s.AllocatableCPU.DeepCopy()
+	headroom.Sub(s.RequestedCPU)
+	return headroom
+}
+
+func (s *CapacitySummary) HeadroomMemory() resource.Quantity {
+	headroom := s.AllocatableMemory.DeepCopy()
+	headroom.Sub(s.RequestedMemory)
+	return headroom
+}
+
+// AddQuota 累加一个组织在该环境下的配额
+func (s *CapacitySummary) AddQuota(quota *NamespaceQuota) {
+	s.QuotaCPU.Add(quota.CPU)
+	s.QuotaMemory.Add(quota.Memory)
+}
+
+func nodeInternalIP(node *v1.Node) string {
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP {
+			return address.Address
+		}
+	}
+	return node.Labels["kubernetes.io/hostname"]
+}
+
+// NodeInventory 列出集群所有节点及其资源使用, 节点没有 zone label 时归属 Conf.Zone
+func (c *Conf) NodeInventory(ctx context.Context) (_ []*NodeInventory, err error) {
+	defer c.wrapError(&err, "NodeInventory", "", "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return nil, err
+	}
+	nodeList, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	podOpts := metav1.ListOptions{FieldSelector: "status.phase!=Succeeded,status.phase!=Failed"}
+	podList, err := clientset.CoreV1().Pods(v1.NamespaceAll).List(ctx, podOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	inventories := make(map[string]*NodeInventory)
+	var result []*NodeInventory
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		inventory := &NodeInventory{
+			Name:              node.Name,
+			IP:                nodeInternalIP(node),
+			Env:               c.Env,
+			Zone:              node.Labels[TopologyKeyZone],
+			Labels:            node.Labels,
+			Taints:            node.Spec.Taints,
+			Conditions:        make(map[v1.NodeConditionType]v1.ConditionStatus),
+			Unschedulable:     node.Spec.Unschedulable,
+			AllocatableCPU:    node.Status.Allocatable.Cpu().DeepCopy(),
+			AllocatableMemory: node.Status.Allocatable.Memory().DeepCopy(),
+			AllocatablePods:   node.Status.Allocatable.Pods().DeepCopy(),
+		}
+		if len(inventory.Zone) == 0 {
+			inventory.Zone = c.Zone
+		}
+		for _, condition := range node.Status.Conditions {
+			inventory.Conditions[condition.Type] = condition.Status
+		}
+		inventories[node.Name] = inventory
+		result = append(result, inventory)
+	}
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		inventory, ok := inventories[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		requests, _ := PodResources(&pod.Spec)
+		inventory.RequestedCPU.Add(*requests.Cpu())
+		inventory.RequestedMemory.Add(*requests.Memory())
+		inventory.Pods++
+	}
+	return result, nil
+}
+
+// SummarizeCapacity 按环境和机房汇总节点容量, 不可调度的节点不计入可分配资源
+func SummarizeCapacity(nodes []*NodeInventory) []*CapacitySummary {
+	summaries := make(map[string]*CapacitySummary)
+	var keys []string
+	for _, node := range nodes {
+		key := node.Env + "/" + node.Zone
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &CapacitySummary{Env: node.Env, Zone: node.Zone}
+			summaries[key] = summary
+			keys = append(keys, key)
+		}
+		summary.Nodes++
+		if !node.Unschedulable {
+			summary.AllocatableCPU.Add(node.AllocatableCPU)
+			summary.AllocatableMemory.Add(node.AllocatableMemory)
+		}
+		summary.RequestedCPU.Add(node.RequestedCPU)
+		summary.RequestedMemory.Add(node.RequestedMemory)
+	}
+	sort.Strings(keys)
+
+	var result []*CapacitySummary
+	for _, key := range keys {
+		result = append(result, summaries[key])
+	}
+	return result
+}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/martian/log"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRestartBatchInterval = 10 * time.Second
+)
+
+// ErrInstanceLost 旧 pod 已经删除, 但没能以同样的名字重建, 需要重新部署该实例
+var ErrInstanceLost = errors.New("instance deleted but not recreated")
+
+// 旧 pod 删除后重建失败时的重试间隔, 超过后按 ErrInstanceLost 报告
+var recreateBackoff = wait.Backoff{Steps: 5, Duration: time.Second, Factor: 2, Jitter: 0.1}
+
+type RestartOptions struct {
+	// 每批重启的实例数, 会被限制为当前就绪实例数减一, 保证应用始终有实例在服务; 为 0 时为 1
+	BatchSize int
+
+	// 两批之间的间隔, 为 0 时为 10 秒
+	BatchInterval time.Duration
+
+	// 每个实例重建后等待就绪的时间, 超时按失败处理; 为 0 时为 5 分钟
+	ReadinessTimeout time.Duration
+
+	// 只有一个实例的应用重启必然中断服务, 需要显式允许
+	AllowDowntime bool
+
+	// 每个实例处理结束后调用, 同一批的实例会并发调用. err 为 nil 表示新 pod 已就绪,
+	// errors.Is(err, ErrInstanceLost) 表示旧 pod 已删除但没有重建, 其他错误时旧 pod 保持原样或新 pod 未就绪
+	Progress func(podName string, err error)
+}
+
+// RestartAppPod 按 pod 当前的 spec 重建实例, 等旧 pod 删除完成后以同样的名字和 IP 创建, 并等待就绪.
+// 删除前先以 DryRun 提交新 pod, 校验或准入不通过时不删除旧 pod
+func (c *Conf) RestartAppPod(ctx context.Context, namespace, podName string) (err error) {
+	defer c.wrapError(&err, "RestartAppPod", namespace, "")
+	return c.restartAppPod(ctx, namespace, podName, podReadinessTimeout)
+}
+
+func (c *Conf) restartAppPod(ctx context.Context, namespace, podName string, readinessTimeout time.Duration) error {
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	old, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	pod := recreatedPod(old)
+	err = dryRunRecreate(ctx, clientset, pod)
+	if err != nil {
+		return fmt.Errorf("dry run recreate: %w", err)
+	}
+
+	propagationPolicy := metav1.DeletePropagationBackground
+	err = c.deleteAppPod(ctx, namespace, podName, metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+	if err != nil {
+		return err
+	}
+
+	// 旧 pod 已经开始删除, 调用方取消后也要把实例建回来
+	recreateCtx, cancel := context.WithTimeout(context.Background(), podDeleteTimeout+time.Minute)
+	defer cancel()
+	err = c.WaitAppPodDeleted(recreateCtx, namespace, podName, podDeleteTimeout)
+	if err == nil {
+		err = retry.OnError(recreateBackoff, func(err error) bool { return !apierrors.IsAlreadyExists(err) }, func() error {
+			_, createErr := clientset.CoreV1().Pods(namespace).Create(recreateCtx, pod, metav1.CreateOptions{})
+			return createErr
+		})
+		if apierrors.IsAlreadyExists(err) {
+			// 旧 pod 删除后被其他操作重建, 例如同时进行的 Drain
+			log.Infof("Pod already recreated,instanceName:%s", podName)
+			err = nil
+		}
+	}
+	if err != nil {
+		log.Errorf("Pod lost,namespace:%s,instanceName:%s,err:%v", namespace, podName, err)
+		return fmt.Errorf("%w: %w", ErrInstanceLost, err)
+	}
+	log.Infof("Pod recreated,instanceName:%s", podName)
+	return c.WaitAppPodReady(ctx, namespace, podName, readinessTimeout)
+}
+
+// dryRunRecreate 旧 pod 还在, 同名冲突和配额超出在旧 pod 删除后都会消失, 不算失败.
+// apiserver 在校验和准入都通过后才检查同名对象
+func dryRunRecreate(ctx context.Context, clientset *kubernetes.Clientset, pod *v1.Pod) error {
+	_, err := clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	if apierrors.IsAlreadyExists(err) || (apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")) {
+		return nil
+	}
+	return err
+}
+
+// recreatedPod 复制 pod 的元数据和 spec, 去掉由 apiserver 和调度器填充的字段
+func recreatedPod(old *v1.Pod) *v1.Pod {
+	pod := &v1.Pod{}
+	pod.APIVersion = "v1"
+	pod.Kind = "Pod"
+	pod.ObjectMeta = metav1.ObjectMeta{
+		Name:        old.Name,
+		Namespace:   old.Namespace,
+		Labels:      old.Labels,
+		Annotations: old.Annotations,
+	}
+	pod.Spec = *old.Spec.DeepCopy()
+	pod.Spec.NodeName = ""
+	return pod
+}
+
+// RestartApp 分批滚动重启应用的所有实例, 每批等待就绪后再继续. 单个实例失败时继续重启其余实例,
+// 最后返回所有失败; 就绪实例不足时由 restartBatchSize 停止, 避免故障扩散到整个应用
+func (c *Conf) RestartApp(ctx context.Context, namespace, appName string, opts RestartOptions) (err error) {
+	defer c.wrapError(&err, "RestartApp", namespace, appName)
+	pods, err := c.QueryAppPods(ctx, namespace, map[string]string{"app": appName})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			names = append(names, pod.Name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("app %s has no instance in %s", appName, namespace)
+	}
+	if len(names) == 1 && !opts.AllowDowntime {
+		return fmt.Errorf("app %s has only one instance, restart would take it down", appName)
+	}
+	sort.Strings(names)
+
+	interval := opts.BatchInterval
+	if interval == 0 {
+		interval = defaultRestartBatchInterval
+	}
+	readinessTimeout := opts.ReadinessTimeout
+	if readinessTimeout == 0 {
+		readinessTimeout = podReadinessTimeout
+	}
+
+	var failed []error
+	for len(names) > 0 {
+		batchSize, err := c.restartBatchSize(ctx, namespace, appName, opts)
+		if err != nil {
+			return errors.Join(append(failed, err)...)
+		}
+		if batchSize > len(names) {
+			batchSize = len(names)
+		}
+		batch := names[:batchSize]
+		names = names[batchSize:]
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(batch))
+		for i, name := range batch {
+			wg.Add(1)
+			go func(i int, name string) {
+				defer wg.Done()
+				errs[i] = c.restartAppPod(ctx, namespace, name, readinessTimeout)
+				if opts.Progress != nil {
+					opts.Progress(name, errs[i])
+				}
+			}(i, name)
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				failed = append(failed, fmt.Errorf("restart instance %s of app %s: %w", batch[i], appName, err))
+			}
+		}
+
+		if len(names) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(append(failed, ctx.Err())...)
+		case <-time.After(interval):
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+	log.Infof("App restarted,namespace:%s,app:%s", namespace, appName)
+	return nil
+}
+
+// restartBatchSize 一批最多重启就绪实例数减一个实例
+func (c *Conf) restartBatchSize(ctx context.Context, namespace, appName string, opts RestartOptions) (int, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	pods, err := c.QueryAppPods(ctx, namespace, map[string]string{"app": appName})
+	if err != nil {
+		return 0, err
+	}
+	ready := 0
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp == nil && isPodReady(&pods.Items[i]) {
+			ready++
+		}
+	}
+	if ready-1 < batchSize {
+		batchSize = ready - 1
+	}
+	if batchSize <= 0 {
+		if !opts.AllowDowntime {
+			return 0, fmt.Errorf("app %s has %d ready instances, restart would take it down", appName, ready)
+		}
+		batchSize = 1
+	}
+	return batchSize, nil
+}
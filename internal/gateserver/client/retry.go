@@ -0,0 +1,258 @@
+package client
+
+import (
+	"errors"
+	"expvar"
+	"github.com/google/martian/log"
+	"io"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	RetryReasonThrottled   = "throttled"
+	RetryReasonServerError = "server-error"
+	RetryReasonTimeout     = "timeout"
+	RetryReasonConnection  = "connection"
+)
+
+// 按 "集群,原因" 统计, 通过 /debug/vars 查看哪些集群不稳定
+var (
+	retryMetrics          = expvar.NewMap("k8s_client_retries")
+	retryExhaustedMetrics = expvar.NewMap("k8s_client_retries_exhausted")
+)
+
+// RetryPolicy 请求 apiserver 遇到 429、5xx、超时、连接失败时按指数退避加抖动重试.
+// 带 Retry-After 的响应由 client-go 自己重试, 这里不再处理, 避免两层重试叠加;
+// 非幂等的 POST 只在 429 时重试, 避免重复创建; 更新冲突由各 Apply 方法的 RetryOnConflict 处理
+type RetryPolicy struct {
+	// 包括第一次在内的最大请求次数
+	Steps    int
+	Duration time.Duration
+	Factor   float64
+	Jitter   float64
+	Cap      time.Duration
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		Steps:    5,
+		Duration: 200 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.2,
+		Cap:      5 * time.Second,
+	}
+}
+
+func (p *RetryPolicy) backoff() wait.Backoff {
+	return wait.Backoff{
+		Steps:    p.Steps,
+		Duration: p.Duration,
+		Factor:   p.Factor,
+		Jitter:   p.Jitter,
+		Cap:      p.Cap,
+	}
+}
+
+// RateLimit 客户端对单个集群的请求限流, 同一集群限流设置相同的 Conf 共用一个令牌桶
+type RateLimit struct {
+	QPS   float32
+	Burst int
+}
+
+func DefaultRateLimit() *RateLimit {
+	return &RateLimit{QPS: 20, Burst: 40}
+}
+
+type rateLimiterKey struct {
+	cluster string
+	limit   RateLimit
+}
+
+var (
+	clusterRateLimitersLock sync.Mutex
+	clusterRateLimiters     = make(map[rateLimiterKey]flowcontrol.RateLimiter)
+)
+
+// clusterRateLimiter 按集群和限流设置共用令牌桶, 设置不同的 Conf 各自限流, 不会被先创建的 Conf 覆盖
+func clusterRateLimiter(cluster string, limit *RateLimit) flowcontrol.RateLimiter {
+	clusterRateLimitersLock.Lock()
+	defer clusterRateLimitersLock.Unlock()
+	key := rateLimiterKey{cluster: cluster, limit: *limit}
+	limiter, ok := clusterRateLimiters[key]
+	if !ok {
+		limiter = flowcontrol.NewTokenBucketRateLimiter(limit.QPS, limit.Burst)
+		clusterRateLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// restConfig 在 RestConf 的基础上加上集群限流和重试, 所有访问集群的操作都应使用它
+func (c *Conf) restConfig() *rest.Config {
+	c.restConfOnce.Do(func() {
+		conf := rest.CopyConfig(c.RestConf)
+		limit := c.RateLimit
+		if limit == nil {
+			limit = DefaultRateLimit()
+		}
+		conf.RateLimiter = clusterRateLimiter(c.Cluster(), limit)
+		policy := c.Retry
+		if policy == nil {
+			policy = DefaultRetryPolicy()
+		}
+		cluster := c.Cluster()
+		conf.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &retryRoundTripper{cluster: cluster, policy: policy, rt: rt}
+		})
+		c.restConf = conf
+	})
+	return c.restConf
+}
+
+func (c *Conf) clientset() (*kubernetes.Clientset, error) {
+	return kubernetes.NewForConfig(c.restConfig())
+}
+
+type retryRoundTripper struct {
+	cluster string
+	policy  *RetryPolicy
+	rt      http.RoundTripper
+}
+
+func (t *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// exec/attach 等升级连接不重试
+	if len(req.Header.Get("Upgrade")) > 0 {
+		return t.rt.RoundTrip(req)
+	}
+	backoff := t.policy.backoff()
+	applied := false
+	for attempt := 1; ; attempt++ {
+		resp, err := t.rt.RoundTrip(req)
+		if applied && err == nil && req.Method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+			// 之前超时、5xx 或连接中断的那次删除实际已经生效, 视为删除成功
+			return deletedResponse(req, resp), nil
+		}
+		reason := retryReason(req, resp, err)
+		if len(reason) == 0 {
+			return resp, err
+		}
+		applied = applied || mayHaveApplied(reason, err)
+		if attempt >= t.policy.Steps || (req.Body != nil && req.GetBody == nil) {
+			retryExhaustedMetrics.Add(t.cluster+","+reason, 1)
+			return resp, err
+		}
+
+		delay := backoff.Step()
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		retryMetrics.Add(t.cluster+","+reason, 1)
+		log.Infof("Kubernetes request retrying,cluster:%s,method:%s,url:%s,reason:%s,attempt:%d,delay:%s", t.cluster, req.Method, req.URL.Path, reason, attempt, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		next := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			next.Body = body
+		}
+		req = next
+	}
+}
+
+// deletedResponse 把重试后 DELETE 得到的 404 替换为成功的 Status
+func deletedResponse(req *http.Request, resp *http.Response) *http.Response {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	log.Infof("Kubernetes delete already applied,method:%s,url:%s", req.Method, req.URL.Path)
+
+	body := `{"kind":"Status","apiVersion":"v1","metadata":{},"status":"Success"}`
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// retryReason 返回需要重试的原因, 为空表示不重试
+func retryReason(req *http.Request, resp *http.Response, err error) string {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return ""
+		}
+		// 连接被拒绝时请求没有发出, POST 也可以安全重试
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return RetryReasonConnection
+		}
+		if !isIdempotent(req.Method) {
+			return ""
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return RetryReasonTimeout
+		}
+		return RetryReasonConnection
+	}
+	if len(resp.Header.Get("Retry-After")) > 0 {
+		return ""
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return RetryReasonThrottled
+	case http.StatusGatewayTimeout:
+		if isIdempotent(req.Method) {
+			return RetryReasonTimeout
+		}
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		if isIdempotent(req.Method) {
+			return RetryReasonServerError
+		}
+	}
+	return ""
+}
+
+// mayHaveApplied 失败的请求是否可能已经被 apiserver 执行: 超时、5xx 和连接中断可能发生在执行之后,
+// 429 和连接被拒绝时请求没有被处理
+func mayHaveApplied(reason string, err error) bool {
+	switch reason {
+	case RetryReasonTimeout, RetryReasonServerError:
+		return true
+	case RetryReasonConnection:
+		return !errors.Is(err, syscall.ECONNREFUSED)
+	}
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
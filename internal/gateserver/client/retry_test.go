@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func newResponse(status int, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(""))}
+}
+
+func TestRetryReason(t *testing.T) {
+	retryAfter := http.Header{"Retry-After": []string{"1"}}
+	refused := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	reset := &net.OpError{Op: "read", Err: syscall.ECONNRESET}
+	tests := []struct {
+		name   string
+		method string
+		resp   *http.Response
+		err    error
+		want   string
+	}{
+		{name: "success", method: http.MethodGet, resp: newResponse(http.StatusOK, nil), want: ""},
+		{name: "not found", method: http.MethodGet, resp: newResponse(http.StatusNotFound, nil), want: ""},
+		{name: "conflict", method: http.MethodPut, resp: newResponse(http.StatusConflict, nil), want: ""},
+		{name: "throttled get", method: http.MethodGet, resp: newResponse(http.StatusTooManyRequests, nil), want: RetryReasonThrottled},
+		{name: "throttled post", method: http.MethodPost, resp: newResponse(http.StatusTooManyRequests, nil), want: RetryReasonThrottled},
+		{name: "retry-after left to client-go", method: http.MethodGet, resp: newResponse(http.StatusTooManyRequests, retryAfter), want: ""},
+		{name: "5xx retry-after left to client-go", method: http.MethodGet, resp: newResponse(http.StatusServiceUnavailable, retryAfter), want: ""},
+		{name: "server error get", method: http.MethodGet, resp: newResponse(http.StatusInternalServerError, nil), want: RetryReasonServerError},
+		{name: "bad gateway delete", method: http.MethodDelete, resp: newResponse(http.StatusBadGateway, nil), want: RetryReasonServerError},
+		{name: "server error post", method: http.MethodPost, resp: newResponse(http.StatusServiceUnavailable, nil), want: ""},
+		{name: "gateway timeout put", method: http.MethodPut, resp: newResponse(http.StatusGatewayTimeout, nil), want: RetryReasonTimeout},
+		{name: "gateway timeout post", method: http.MethodPost, resp: newResponse(http.StatusGatewayTimeout, nil), want: ""},
+		{name: "not implemented", method: http.MethodGet, resp: newResponse(http.StatusNotImplemented, nil), want: ""},
+		{name: "net timeout get", method: http.MethodGet, err: timeoutError{}, want: RetryReasonTimeout},
+		{name: "net timeout post", method: http.MethodPost, err: timeoutError{}, want: ""},
+		{name: "connection reset get", method: http.MethodGet, err: reset, want: RetryReasonConnection},
+		{name: "connection refused post", method: http.MethodPost, err: refused, want: RetryReasonConnection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "https://apiserver/api/v1/pods", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := retryReason(req, tt.resp, tt.err); got != tt.want {
+				t.Errorf("retryReason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryReasonCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://apiserver/api/v1/pods", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := retryReason(req, nil, context.Canceled); got != "" {
+		t.Errorf("retryReason for canceled request = %q, want empty", got)
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestRetryRoundTripper(responses ...func() (*http.Response, error)) (*retryRoundTripper, *int) {
+	calls := 0
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		i := calls
+		calls++
+		if i >= len(responses) {
+			i = len(responses) - 1
+		}
+		return responses[i]()
+	})
+	policy := &RetryPolicy{Steps: 3, Duration: time.Millisecond, Factor: 1}
+	return &retryRoundTripper{cluster: "test", policy: policy, rt: rt}, &calls
+}
+
+func TestRetryRoundTripper(t *testing.T) {
+	status := func(code int, header http.Header) func() (*http.Response, error) {
+		return func() (*http.Response, error) { return newResponse(code, header), nil }
+	}
+	failure := func(err error) func() (*http.Response, error) {
+		return func() (*http.Response, error) { return nil, err }
+	}
+	tests := []struct {
+		name       string
+		method     string
+		responses  []func() (*http.Response, error)
+		wantStatus int
+		wantErr    bool
+		wantCalls  int
+	}{
+		{name: "retry until success", method: http.MethodGet, responses: []func() (*http.Response, error){status(503, nil), status(200, nil)}, wantStatus: 200, wantCalls: 2},
+		{name: "give up after steps", method: http.MethodGet, responses: []func() (*http.Response, error){status(500, nil)}, wantStatus: 500, wantCalls: 3},
+		{name: "retry-after not retried", method: http.MethodGet, responses: []func() (*http.Response, error){status(429, http.Header{"Retry-After": []string{"1"}})}, wantStatus: 429, wantCalls: 1},
+		{name: "post not retried on 5xx", method: http.MethodPost, responses: []func() (*http.Response, error){status(500, nil)}, wantStatus: 500, wantCalls: 1},
+		{name: "repeated delete is success", method: http.MethodDelete, responses: []func() (*http.Response, error){failure(timeoutError{}), status(404, nil)}, wantStatus: 200, wantCalls: 2},
+		{name: "delete 404 after reset is success", method: http.MethodDelete, responses: []func() (*http.Response, error){
+			failure(&net.OpError{Op: "read", Err: syscall.ECONNRESET}), status(404, nil)}, wantStatus: 200, wantCalls: 2},
+		{name: "delete 404 after throttle kept", method: http.MethodDelete, responses: []func() (*http.Response, error){status(429, nil), status(404, nil)}, wantStatus: 404, wantCalls: 2},
+		{name: "delete 404 after refused kept", method: http.MethodDelete, responses: []func() (*http.Response, error){
+			failure(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), status(404, nil)}, wantStatus: 404, wantCalls: 2},
+		{name: "first delete 404 kept", method: http.MethodDelete, responses: []func() (*http.Response, error){status(404, nil)}, wantStatus: 404, wantCalls: 1},
+		{name: "error returned after steps", method: http.MethodGet, responses: []func() (*http.Response, error){failure(timeoutError{})}, wantErr: true, wantCalls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, calls := newTestRetryRoundTripper(tt.responses...)
+			req, err := http.NewRequest(tt.method, "https://apiserver/api/v1/namespaces/ns/pods/p", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RoundTrip error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && resp.StatusCode != tt.wantStatus {
+				t.Errorf("RoundTrip status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("RoundTrip calls = %d, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryRoundTripperReplaysBody(t *testing.T) {
+	var bodies []string
+	calls := 0
+	rt := &retryRoundTripper{
+		cluster: "test",
+		policy:  &RetryPolicy{Steps: 3, Duration: time.Millisecond, Factor: 1},
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			data, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			bodies = append(bodies, string(data))
+			if calls == 1 {
+				return newResponse(http.StatusServiceUnavailable, nil), nil
+			}
+			return newResponse(http.StatusOK, nil), nil
+		}),
+	}
+	req, err := http.NewRequest(http.MethodPut, "https://apiserver/api/v1/namespaces/ns", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || bodies[0] != bodies[1] {
+		t.Errorf("request bodies = %q, want the same body twice", bodies)
+	}
+}
+
+func TestClusterRateLimiter(t *testing.T) {
+	limit := &RateLimit{QPS: 5, Burst: 10}
+	if clusterRateLimiter("a", limit) != clusterRateLimiter("a", &RateLimit{QPS: 5, Burst: 10}) {
+		t.Errorf("same cluster and limit should share a rate limiter")
+	}
+	if clusterRateLimiter("a", limit) == clusterRateLimiter("b", limit) {
+		t.Errorf("different clusters should not share a rate limiter")
+	}
+	other := clusterRateLimiter("a", &RateLimit{QPS: 50, Burst: 100})
+	if other == clusterRateLimiter("a", limit) || other.QPS() != 50 {
+		t.Errorf("a different limit on the same cluster should get its own rate limiter")
+	}
+}
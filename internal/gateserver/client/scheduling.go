@@ -0,0 +1,157 @@
+package client
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	AntiAffinityNone      = "none"
+	AntiAffinityPreferred = "preferred"
+	AntiAffinityRequired  = "required"
+
+	TopologyKeyHostname = "kubernetes.io/hostname"
+	TopologyKeyZone     = "topology.kubernetes.io/zone"
+)
+
+// Scheduling 应用实例的调度约束, 反亲和与打散都基于 app label
+type Scheduling struct {
+	NodeSelector map[string]string
+
+	// AntiAffinityNone/AntiAffinityPreferred/AntiAffinityRequired, 同一应用的实例不放在同一节点.
+	// 为空表示未设置, 开启高可用时使用 AntiAffinityPreferred, 否则不设置反亲和
+	PodAntiAffinity string
+
+	Tolerations []v1.Toleration
+
+	TopologySpread []TopologySpread
+}
+
+type TopologySpread struct {
+	TopologyKey       string
+	MaxSkew           int32
+	WhenUnsatisfiable v1.UnsatisfiableConstraintAction
+}
+
+// haScheduling 开启高可用的应用没有配置调度约束时, 尽量把实例打散到不同机房和节点
+func haScheduling() Scheduling {
+	return Scheduling{
+		PodAntiAffinity: AntiAffinityPreferred,
+		TopologySpread: []TopologySpread{
+			{TopologyKey: TopologyKeyZone, MaxSkew: 1, WhenUnsatisfiable: v1.ScheduleAnyway},
+			{TopologyKey: TopologyKeyHostname, MaxSkew: 1, WhenUnsatisfiable: v1.ScheduleAnyway},
+		},
+	}
+}
+
+func resolveScheduling(template *AppPodTemplate) Scheduling {
+	scheduling := template.Scheduling
+	if template.EnableHa {
+		ha := haScheduling()
+		if len(scheduling.PodAntiAffinity) == 0 {
+			scheduling.PodAntiAffinity = ha.PodAntiAffinity
+		}
+		if len(scheduling.TopologySpread) == 0 {
+			scheduling.TopologySpread = ha.TopologySpread
+		}
+	}
+	return scheduling
+}
+
+func applyScheduling(template *AppPodTemplate, podSpec *v1.PodSpec) {
+	scheduling := resolveScheduling(template)
+	appSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": template.AppName}}
+
+	if len(scheduling.NodeSelector) > 0 {
+		podSpec.NodeSelector = make(map[string]string)
+		for k, v := range scheduling.NodeSelector {
+			podSpec.NodeSelector[k] = v
+		}
+	}
+
+	podSpec.Tolerations = append(podSpec.Tolerations, scheduling.Tolerations...)
+
+	term := v1.PodAffinityTerm{
+		LabelSelector: appSelector,
+		TopologyKey:   TopologyKeyHostname,
+	}
+	switch scheduling.PodAntiAffinity {
+	case AntiAffinityPreferred:
+		if podSpec.Affinity == nil {
+			podSpec.Affinity = &v1.Affinity{}
+		}
+		podSpec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{
+				{Weight: 100, PodAffinityTerm: term},
+			},
+		}
+	case AntiAffinityRequired:
+		if podSpec.Affinity == nil {
+			podSpec.Affinity = &v1.Affinity{}
+		}
+		podSpec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term},
+		}
+	}
+
+	for _, spread := range scheduling.TopologySpread {
+		constraint := v1.TopologySpreadConstraint{}
+		constraint.TopologyKey = spread.TopologyKey
+		constraint.MaxSkew = spread.MaxSkew
+		if constraint.MaxSkew <= 0 {
+			constraint.MaxSkew = 1
+		}
+		constraint.WhenUnsatisfiable = spread.WhenUnsatisfiable
+		if len(constraint.WhenUnsatisfiable) == 0 {
+			constraint.WhenUnsatisfiable = v1.ScheduleAnyway
+		}
+		constraint.LabelSelector = appSelector
+		podSpec.TopologySpreadConstraints = append(podSpec.TopologySpreadConstraints, constraint)
+	}
+}
+
+func validateScheduling(scheduling Scheduling, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for k, v := range scheduling.NodeSelector {
+		for _, msg := range validation.IsQualifiedName(k) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("NodeSelector"), k, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(v) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("NodeSelector").Key(k), v, msg))
+		}
+	}
+
+	switch scheduling.PodAntiAffinity {
+	case "", AntiAffinityNone, AntiAffinityPreferred, AntiAffinityRequired:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("PodAntiAffinity"), scheduling.PodAntiAffinity,
+			[]string{AntiAffinityNone, AntiAffinityPreferred, AntiAffinityRequired}))
+	}
+
+	for i, toleration := range scheduling.Tolerations {
+		if toleration.Operator == v1.TolerationOpExists && len(toleration.Value) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("Tolerations").Index(i).Child("Value"), toleration.Value,
+				"value must be empty when operator is Exists"))
+		}
+	}
+
+	for i, spread := range scheduling.TopologySpread {
+		idxPath := fldPath.Child("TopologySpread").Index(i)
+		if len(spread.TopologyKey) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("TopologyKey"), ""))
+		}
+		if spread.MaxSkew < 0 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("MaxSkew"), spread.MaxSkew, "must be greater than zero"))
+		}
+		switch spread.WhenUnsatisfiable {
+		case "", v1.DoNotSchedule, v1.ScheduleAnyway:
+		default:
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("WhenUnsatisfiable"), spread.WhenUnsatisfiable,
+				[]string{string(v1.DoNotSchedule), string(v1.ScheduleAnyway)}))
+		}
+	}
+	return allErrs
+}
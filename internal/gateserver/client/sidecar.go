@@ -0,0 +1,273 @@
+package client
+
+import (
+	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Sidecar 与应用容器运行在同一个 pod 中的辅助容器, 例如日志采集、服务网格代理、JMX exporter,
+// 也用于描述配置拉取、预热这类 init container
+type Sidecar struct {
+	Name         string
+	Image        string
+	Command      []string
+	Args         []string
+	Env          []v1.EnvVar
+	Ports        []v1.ContainerPort
+	Resources    v1.ResourceRequirements
+	VolumeMounts []v1.VolumeMount
+}
+
+// SharedVolume pod 内容器共享的 emptyDir, MountPath 非空时同时挂载到应用容器
+type SharedVolume struct {
+	Name      string
+	MountPath string
+	Medium    v1.StorageMedium
+	SizeLimit *resource.Quantity
+}
+
+// 没有声明资源的 sidecar 按该默认值计入 pod, 否则 LimitRange 会给它默认值, 使 pod 超出 K8sQuota
+var (
+	DefaultSidecarRequests = v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("50m"),
+		v1.ResourceMemory: resource.MustParse("64Mi"),
+	}
+	DefaultSidecarLimits = v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("200m"),
+		v1.ResourceMemory: resource.MustParse("128Mi"),
+	}
+)
+
+// resources 补全 cpu/memory 的 requests 和 limits: 只有 limit 时 request 等于 limit, 与 k8s 一致;
+// 只有 request 时 limit 等于 request; 都没有时使用默认值
+func (s *Sidecar) resources() v1.ResourceRequirements {
+	requirements := v1.ResourceRequirements{
+		Requests: v1.ResourceList{},
+		Limits:   v1.ResourceList{},
+	}
+	for name, quantity := range s.Resources.Requests {
+		requirements.Requests[name] = quantity.DeepCopy()
+	}
+	for name, quantity := range s.Resources.Limits {
+		requirements.Limits[name] = quantity.DeepCopy()
+	}
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		request, hasRequest := requirements.Requests[name]
+		limit, hasLimit := requirements.Limits[name]
+		switch {
+		case hasRequest && !hasLimit:
+			requirements.Limits[name] = request.DeepCopy()
+		case !hasRequest && hasLimit:
+			requirements.Requests[name] = limit.DeepCopy()
+		case !hasRequest && !hasLimit:
+			requirements.Requests[name] = DefaultSidecarRequests[name].DeepCopy()
+			requirements.Limits[name] = DefaultSidecarLimits[name].DeepCopy()
+		}
+	}
+	return requirements
+}
+
+func (s *Sidecar) container() v1.Container {
+	v1Container := v1.Container{}
+	v1Container.Name = s.Name
+	v1Container.Image = s.Image
+	v1Container.ImagePullPolicy = "IfNotPresent"
+	v1Container.Command = s.Command
+	v1Container.Args = s.Args
+	v1Container.Env = s.Env
+	v1Container.Ports = s.Ports
+	v1Container.Resources = s.resources()
+	v1Container.VolumeMounts = s.VolumeMounts
+	return v1Container
+}
+
+func createSharedVolumes(sharedVolumes []SharedVolume) []v1.Volume {
+	var v1Volumes []v1.Volume
+	for _, shared := range sharedVolumes {
+		v1Volume := v1.Volume{}
+		v1Volume.Name = shared.Name
+		v1Volume.EmptyDir = &v1.EmptyDirVolumeSource{Medium: shared.Medium, SizeLimit: shared.SizeLimit}
+		v1Volumes = append(v1Volumes, v1Volume)
+	}
+	return v1Volumes
+}
+
+func createSharedVolumeMounts(sharedVolumes []SharedVolume) []v1.VolumeMount {
+	var volumeMounts []v1.VolumeMount
+	for _, shared := range sharedVolumes {
+		if len(shared.MountPath) == 0 {
+			continue
+		}
+		v1VolumeMount := v1.VolumeMount{}
+		v1VolumeMount.Name = shared.Name
+		v1VolumeMount.MountPath = shared.MountPath
+		volumeMounts = append(volumeMounts, v1VolumeMount)
+	}
+	return volumeMounts
+}
+
+// applySidecars 加入 sidecar 和 init container, sidecar 的 limits 从应用容器的 requests 和 limits 中同时扣除,
+// 保证整个 pod 不超过 K8sQuota, 且生产环境内存 request 等于 limit 时扣除后仍然相等.
+// init container 不与应用容器同时运行, 只要求不超过应用容器原有的配额
+func applySidecars(template *AppPodTemplate, podSpec *v1.PodSpec, container *v1.Container) error {
+	podSpec.Volumes = append(podSpec.Volumes, createSharedVolumes(template.SharedVolumes)...)
+	container.VolumeMounts = append(container.VolumeMounts, createSharedVolumeMounts(template.SharedVolumes)...)
+
+	for _, initContainer := range template.InitContainers {
+		v1Container := initContainer.container()
+		err := checkResourcesFit(container.Resources.Requests, v1Container.Resources.Requests)
+		if err != nil {
+			return fmt.Errorf("init container %s requests exceed app quota: %w", initContainer.Name, err)
+		}
+		err = checkResourcesFit(container.Resources.Limits, v1Container.Resources.Limits)
+		if err != nil {
+			return fmt.Errorf("init container %s limits exceed app quota: %w", initContainer.Name, err)
+		}
+		podSpec.InitContainers = append(podSpec.InitContainers, v1Container)
+	}
+
+	for _, sidecar := range template.Sidecars {
+		v1Container := sidecar.container()
+		err := subtractResources(container.Resources.Requests, v1Container.Resources.Limits)
+		if err != nil {
+			return fmt.Errorf("sidecar %s limits exceed app requests: %w", sidecar.Name, err)
+		}
+		err = subtractResources(container.Resources.Limits, v1Container.Resources.Limits)
+		if err != nil {
+			return fmt.Errorf("sidecar %s limits exceed app quota: %w", sidecar.Name, err)
+		}
+		podSpec.Containers = append(podSpec.Containers, v1Container)
+	}
+
+	if len(template.Sidecars) > 0 {
+		err := checkResourcesFit(container.Resources.Limits, container.Resources.Requests)
+		if err != nil {
+			return fmt.Errorf("app requests exceed limits after sidecars: %w", err)
+		}
+		memory, ok := container.Resources.Limits[v1.ResourceMemory]
+		if ok {
+			err = checkJavaOptsFit(template.K8sQuota.GetJavaOpts(), memory)
+			if err != nil {
+				return fmt.Errorf("app memory limit after sidecars: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkResourcesFit(total v1.ResourceList, used v1.ResourceList) error {
+	for name, quantity := range used {
+		origin, ok := total[name]
+		if ok && quantity.Cmp(origin) > 0 {
+			return fmt.Errorf("%s %s of %s", name, quantity.String(), origin.String())
+		}
+	}
+	return nil
+}
+
+func subtractResources(total v1.ResourceList, used v1.ResourceList) error {
+	for name, quantity := range used {
+		origin, ok := total[name]
+		if !ok {
+			continue
+		}
+		remain := origin.DeepCopy()
+		remain.Sub(quantity)
+		if remain.Sign() <= 0 {
+			return fmt.Errorf("%s %s of %s", name, quantity.String(), origin.String())
+		}
+		total[name] = remain
+	}
+	return nil
+}
+
+// PodResources 按 k8s 的规则计算 pod 的有效资源: 所有容器之和与最大 init container 取大
+func PodResources(spec *v1.PodSpec) (requests v1.ResourceList, limits v1.ResourceList) {
+	requests = v1.ResourceList{}
+	limits = v1.ResourceList{}
+	for _, container := range spec.Containers {
+		addResources(requests, container.Resources.Requests)
+		addResources(limits, container.Resources.Limits)
+	}
+	for _, container := range spec.InitContainers {
+		maxResources(requests, container.Resources.Requests)
+		maxResources(limits, container.Resources.Limits)
+	}
+	return requests, limits
+}
+
+func addResources(total v1.ResourceList, list v1.ResourceList) {
+	for name, quantity := range list {
+		if value, ok := total[name]; ok {
+			value.Add(quantity)
+			total[name] = value
+		} else {
+			total[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+func maxResources(total v1.ResourceList, list v1.ResourceList) {
+	for name, quantity := range list {
+		if value, ok := total[name]; !ok || quantity.Cmp(value) > 0 {
+			total[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// builtinVolumeNames pod 模板和 mutator 自带的 volume, SharedVolumes 不能与之重名
+func (t *AppPodTemplate) builtinVolumeNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range lxcfsProcFiles {
+		names[name] = true
+	}
+	names[localtimeVolumeName] = true
+	names[dataVolumeName] = true
+	for _, cfg := range t.Configs {
+		names[appConfigVolumeName(cfg)] = true
+	}
+	return names
+}
+
+// validateSidecars 检查 sidecar 与应用容器及其他 sidecar 的名称冲突, containerNames 记录已经使用的容器名.
+// sidecar 只能挂载 SharedVolumes 中声明的 volume
+func validateSidecars(sidecars []Sidecar, containerNames map[string]bool, sharedVolumes []SharedVolume, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	volumeNames := make(map[string]bool)
+	for _, shared := range sharedVolumes {
+		volumeNames[shared.Name] = true
+	}
+	for i, sidecar := range sidecars {
+		idxPath := fldPath.Index(i)
+		allErrs = append(allErrs, validateDNS1123Label(sidecar.Name, idxPath.Child("Name"))...)
+		if containerNames[sidecar.Name] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("Name"), sidecar.Name))
+		}
+		containerNames[sidecar.Name] = true
+		if len(sidecar.Image) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("Image"), ""))
+		}
+		for j, mount := range sidecar.VolumeMounts {
+			if !volumeNames[mount.Name] {
+				allErrs = append(allErrs, field.NotFound(idxPath.Child("VolumeMounts").Index(j).Child("Name"), mount.Name))
+			}
+		}
+	}
+	return allErrs
+}
+
+func validateSharedVolumes(sharedVolumes []SharedVolume, builtinNames map[string]bool, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	names := make(map[string]bool)
+	for i, shared := range sharedVolumes {
+		idxPath := fldPath.Index(i)
+		allErrs = append(allErrs, validateDNS1123Label(shared.Name, idxPath.Child("Name"))...)
+		if names[shared.Name] || builtinNames[shared.Name] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("Name"), shared.Name))
+		}
+		names[shared.Name] = true
+	}
+	return allErrs
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"testing"
+)
+
+func TestSidecarResources(t *testing.T) {
+	tests := []struct {
+		name        string
+		resources   v1.ResourceRequirements
+		wantRequest string
+		wantLimit   string
+	}{
+		{name: "defaults", wantRequest: "64Mi", wantLimit: "128Mi"},
+		{name: "limit only", resources: v1.ResourceRequirements{
+			Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+		}, wantRequest: "256Mi", wantLimit: "256Mi"},
+		{name: "request only", resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("32Mi")},
+		}, wantRequest: "32Mi", wantLimit: "32Mi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sidecar := Sidecar{Name: "filebeat", Image: "filebeat", Resources: tt.resources}
+			got := sidecar.resources()
+			request := got.Requests[v1.ResourceMemory]
+			limit := got.Limits[v1.ResourceMemory]
+			if request.String() != tt.wantRequest || limit.String() != tt.wantLimit {
+				t.Errorf("memory request/limit = %s/%s, want %s/%s", request.String(), limit.String(), tt.wantRequest, tt.wantLimit)
+			}
+			if _, ok := got.Limits[v1.ResourceCPU]; !ok {
+				t.Errorf("cpu limit not set")
+			}
+		})
+	}
+}
+
+func TestApplySidecars(t *testing.T) {
+	tests := []struct {
+		name           string
+		javaOpts       string
+		memRequest     string
+		sidecars       []Sidecar
+		initContainer  []Sidecar
+		wantErr        bool
+		wantMemRequest string
+		wantMemLimit   string
+	}{
+		{name: "no sidecar keeps quota", javaOpts: "-Xmx1920m", wantMemRequest: "1Gi", wantMemLimit: "2Gi"},
+		{name: "default sidecar charged", sidecars: []Sidecar{{Name: "filebeat", Image: "filebeat"}}, wantMemRequest: "896Mi", wantMemLimit: "1920Mi"},
+		{name: "request equal to limit stays equal", memRequest: "2Gi", sidecars: []Sidecar{{Name: "filebeat", Image: "filebeat"}},
+			wantMemRequest: "1920Mi", wantMemLimit: "1920Mi"},
+		{name: "request above limit", memRequest: "3Gi", sidecars: []Sidecar{{Name: "filebeat", Image: "filebeat"}}, wantErr: true},
+		{name: "heap no longer fits", javaOpts: "-Xmx1920m", sidecars: []Sidecar{{Name: "filebeat", Image: "filebeat"}}, wantErr: true},
+		{name: "sidecar exceeds quota", sidecars: []Sidecar{{Name: "envoy", Image: "envoy", Resources: v1.ResourceRequirements{
+			Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("2Gi")},
+		}}}, wantErr: true},
+		{name: "init container exceeds quota", initContainer: []Sidecar{{Name: "warmup", Image: "warmup", Resources: v1.ResourceRequirements{
+			Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+		}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := validTemplate()
+			template.K8sQuota = testQuota{javaOpts: tt.javaOpts}
+			template.Sidecars = tt.sidecars
+			template.InitContainers = tt.initContainer
+			memRequest := resource.MustParse("1Gi")
+			if len(tt.memRequest) > 0 {
+				memRequest = resource.MustParse(tt.memRequest)
+			}
+			podSpec := &v1.PodSpec{Containers: []v1.Container{{Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m"), v1.ResourceMemory: memRequest},
+				Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("2Gi")},
+			}}}}
+			err := applySidecars(template, podSpec, &podSpec.Containers[0])
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applySidecars error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			request := podSpec.Containers[0].Resources.Requests[v1.ResourceMemory]
+			limit := podSpec.Containers[0].Resources.Limits[v1.ResourceMemory]
+			if request.String() != tt.wantMemRequest || limit.String() != tt.wantMemLimit {
+				t.Errorf("app memory request/limit = %s/%s, want %s/%s", request.String(), limit.String(), tt.wantMemRequest, tt.wantMemLimit)
+			}
+			podRequests, podLimits := PodResources(podSpec)
+			podRequest := podRequests[v1.ResourceMemory]
+			if podRequest.Cmp(memRequest) > 0 {
+				t.Errorf("pod memory request %s exceeds quota %s", podRequest.String(), memRequest.String())
+			}
+			podLimit := podLimits[v1.ResourceMemory]
+			if podLimit.Cmp(resource.MustParse("2Gi")) > 0 {
+				t.Errorf("pod memory limit %s exceeds quota 2Gi", podLimit.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+const (
+	DefaultTimezone = "Asia/Shanghai"
+	DefaultLocale   = "en_US.UTF-8"
+
+	zoneinfoDir         = "/usr/share/zoneinfo/"
+	localtimeVolumeName = "localtime"
+)
+
+// language[_territory][.codeset][@modifier], 以及 C/POSIX
+var localeRegexp = regexp.MustCompile(`^([a-z]{2,3}(_[A-Z]{2})?|C|POSIX)(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+
+// resolveTimezone 应用配置优先, 其次是环境配置, 都没有时使用 DefaultTimezone
+func (c *Conf) resolveTimezone(template *AppPodTemplate) string {
+	if len(template.Timezone) > 0 {
+		return template.Timezone
+	}
+	if len(c.Timezone) > 0 {
+		return c.Timezone
+	}
+	return DefaultTimezone
+}
+
+func (c *Conf) resolveLocale(template *AppPodTemplate) string {
+	if len(template.Locale) > 0 {
+		return template.Locale
+	}
+	if len(c.Locale) > 0 {
+		return c.Locale
+	}
+	return DefaultLocale
+}
+
+// ValidateTimezone 检查时区是否存在于 zoneinfo 数据库中, 只接受 Area/Location 这类名称
+func ValidateTimezone(tz string) error {
+	if tz == "Local" || strings.HasPrefix(tz, "/") || strings.Contains(tz, "..") {
+		return fmt.Errorf("timezone %s is not a zoneinfo name", tz)
+	}
+	_, err := time.LoadLocation(tz)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %s", tz)
+	}
+	return nil
+}
+
+func ValidateLocale(locale string) error {
+	if !localeRegexp.MatchString(locale) {
+		return fmt.Errorf("invalid locale %s", locale)
+	}
+	return nil
+}
+
+func validateTimezoneField(tz string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(tz) == 0 {
+		return allErrs
+	}
+	if err := ValidateTimezone(tz); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, tz, err.Error()))
+	}
+	return allErrs
+}
+
+func validateLocaleField(locale string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(locale) == 0 {
+		return allErrs
+	}
+	if err := ValidateLocale(locale); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, locale, err.Error()))
+	}
+	return allErrs
+}
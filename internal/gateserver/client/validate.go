@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"regexp"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+const (
+	RenderFormatYAML = "yaml"
+	RenderFormatJSON = "json"
+)
+
+// 与 kubelet 的 sysctl 名称校验规则一致
+var sysctlNameRegexp = regexp.MustCompile(`^([a-z0-9]([-_a-z0-9]*[a-z0-9])?[\./])*[a-z0-9]([-_a-z0-9]*[a-z0-9])?$`)
+
+// Validate 在提交 apiserver 之前检查模板, 返回按字段定位的错误
+func (t *AppPodTemplate) Validate() field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateDNS1123Label(t.Namespace, field.NewPath("Namespace"))...)
+
+	appNamePath := field.NewPath("AppName")
+	if len(t.AppName) == 0 {
+		allErrs = append(allErrs, field.Required(appNamePath, ""))
+	} else {
+		allErrs = append(allErrs, validateLabelValue(t.AppName, appNamePath)...)
+		for _, msg := range validation.IsDNS1123Label(getServiceFromAppName(t.AppName)) {
+			allErrs = append(allErrs, field.Invalid(appNamePath, t.AppName, "service name: "+msg))
+		}
+		for _, msg := range validation.IsDNS1123Label(formatContainerName(t.AppName)) {
+			allErrs = append(allErrs, field.Invalid(appNamePath, t.AppName, "container name: "+msg))
+		}
+	}
+
+	appIDPath := field.NewPath("AppID")
+	if len(t.AppID) == 0 {
+		allErrs = append(allErrs, field.Required(appIDPath, ""))
+	} else {
+		allErrs = append(allErrs, validateLabelValue(t.AppID, appIDPath)...)
+	}
+
+	if len(t.Image) == 0 {
+		allErrs = append(allErrs, field.Required(field.NewPath("Image"), ""))
+	}
+
+	if t.K8sQuota == nil {
+		allErrs = append(allErrs, field.Required(field.NewPath("K8sQuota"), ""))
+	}
+
+	podNamePath := field.NewPath("PodName")
+	if len(t.PodName) == 0 {
+		allErrs = append(allErrs, field.Required(podNamePath, ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(t.PodName) {
+			allErrs = append(allErrs, field.Invalid(podNamePath, t.PodName, msg))
+		}
+		for _, msg := range validation.IsDNS1123Label(formatHostname(t.PodName)) {
+			allErrs = append(allErrs, field.Invalid(podNamePath, t.PodName, "hostname: "+msg))
+		}
+		allErrs = append(allErrs, validateLabelValue(t.PodName, podNamePath)...)
+	}
+
+	if len(t.Hostname) > 0 {
+		allErrs = append(allErrs, validateDNS1123Label(t.Hostname, field.NewPath("Hostname"))...)
+	}
+
+	if len(t.PodIP) > 0 {
+		allErrs = append(allErrs, validateIP(t.PodIP, field.NewPath("PodIP"))...)
+	}
+
+	if len(t.Dns) > 0 {
+		allErrs = append(allErrs, validateIP(t.Dns, field.NewPath("Dns"))...)
+	}
+
+	if t.Port != 0 {
+		for _, msg := range validation.IsValidPortNum(int(t.Port)) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("Port"), t.Port, msg))
+		}
+	}
+
+	allErrs = append(allErrs, validateSysctls(t.Sysctl, field.NewPath("Sysctl"))...)
+	allErrs = append(allErrs, validateTimezoneField(t.Timezone, field.NewPath("Timezone"))...)
+	allErrs = append(allErrs, validateLocaleField(t.Locale, field.NewPath("Locale"))...)
+
+	allErrs = append(allErrs, validateScheduling(t.Scheduling, field.NewPath("Scheduling"))...)
+	allErrs = append(allErrs, validateShutdown(t.Shutdown, field.NewPath("Shutdown"))...)
+
+	containerNames := map[string]bool{formatContainerName(t.AppName): true}
+	allErrs = append(allErrs, validateSidecars(t.Sidecars, containerNames, t.SharedVolumes, field.NewPath("Sidecars"))...)
+	allErrs = append(allErrs, validateSidecars(t.InitContainers, containerNames, t.SharedVolumes, field.NewPath("InitContainers"))...)
+	allErrs = append(allErrs, validateSharedVolumes(t.SharedVolumes, t.builtinVolumeNames(), field.NewPath("SharedVolumes"))...)
+	allErrs = append(allErrs, validateDataVolume(t.DataVolume, field.NewPath("DataVolume"))...)
+
+	for i, cfg := range t.Configs {
+		allErrs = append(allErrs, validateDNS1123Label(cfg.Name, field.NewPath("Configs").Index(i).Child("Name"))...)
+	}
+
+	for i, secretEnv := range t.SecretEnvs {
+		secretEnvPath := field.NewPath("SecretEnvs").Index(i)
+		if len(secretEnv.Name) == 0 {
+			allErrs = append(allErrs, field.Required(secretEnvPath.Child("Name"), ""))
+		}
+		if len(secretEnv.Key) == 0 {
+			allErrs = append(allErrs, field.Required(secretEnvPath.Child("Key"), ""))
+		}
+		allErrs = append(allErrs, validateDNS1123Subdomain(secretEnv.SecretName, secretEnvPath.Child("SecretName"))...)
+	}
+
+	return allErrs
+}
+
+func validateDNS1123Label(value string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(value) == 0 {
+		return append(allErrs, field.Required(fldPath, ""))
+	}
+	for _, msg := range validation.IsDNS1123Label(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+func validateDNS1123Subdomain(value string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(value) == 0 {
+		return append(allErrs, field.Required(fldPath, ""))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+func validateLabelValue(value string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsValidLabelValue(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, "label value: "+msg))
+	}
+	return allErrs
+}
+
+func validateIP(value string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsValidIP(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+func validateSysctls(sysctl string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(strings.TrimSpace(sysctl)) == 0 {
+		return allErrs
+	}
+	for i, s := range strings.Split(sysctl, ",") {
+		s = strings.TrimSpace(s)
+		pair := strings.SplitN(s, "=", 2)
+		if len(pair) != 2 || len(pair[1]) == 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), s, "must be in the form name=value"))
+			continue
+		}
+		if !sysctlNameRegexp.MatchString(pair[0]) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), pair[0], "must be a valid sysctl name"))
+		}
+	}
+	return allErrs
+}
+
+// RenderPod 校验模板并返回 DeployAppPod 会提交的 pod, 不访问集群
+func (c *Conf) RenderPod(template *AppPodTemplate) (*v1.Pod, error) {
+	if errs := template.Validate(); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return c.createPod(template)
+}
+
+// RenderPodManifest 以 yaml 或 json 格式输出 RenderPod 的结果
+func (c *Conf) RenderPodManifest(template *AppPodTemplate, format string) ([]byte, error) {
+	pod, err := c.RenderPod(template)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case RenderFormatYAML:
+		return yaml.Marshal(pod)
+	case RenderFormatJSON:
+		return json.MarshalIndent(pod, "", "  ")
+	default:
+		return nil, fmt.Errorf("unsupported render format %s", format)
+	}
+}
+
+// DryRunAppPod 以 DryRun=All 提交 pod, 由 apiserver 做完整校验和准入, 返回服务端处理后的 pod
+func (c *Conf) DryRunAppPod(ctx context.Context, template *AppPodTemplate) (_ *v1.Pod, err error) {
+	defer c.wrapError(&err, "DryRunAppPod", template.Namespace, template.AppName)
+	pod, err := c.RenderPod(template)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := c.clientset()
+	if err != nil {
+		return nil, err
+	}
+	opts := metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	return clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, opts)
+}
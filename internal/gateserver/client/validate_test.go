@@ -0,0 +1,117 @@
+package client
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"testing"
+)
+
+type testQuota struct {
+	javaOpts string
+}
+
+func (q testQuota) GetRequestCPU() resource.Quantity    { return resource.MustParse("500m") }
+func (q testQuota) GetRequestMemory() resource.Quantity { return resource.MustParse("1Gi") }
+func (q testQuota) GetLimitCPU() resource.Quantity      { return resource.MustParse("1") }
+func (q testQuota) GetLimitMemory() resource.Quantity   { return resource.MustParse("2Gi") }
+func (q testQuota) GetScope() string                    { return "normal" }
+func (q testQuota) GetJavaOpts() string                 { return q.javaOpts }
+
+func validTemplate() *AppPodTemplate {
+	return &AppPodTemplate{
+		Namespace: "trade",
+		AppID:     "100",
+		AppName:   "order.service",
+		Image:     "registry.example.com/order:1.0",
+		K8sQuota:  testQuota{},
+		PodName:   "order-service-fat-1",
+		PodIP:     "10.0.0.10",
+		Dns:       "10.0.0.2",
+		Port:      8080,
+	}
+}
+
+func TestAppPodTemplateValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		mutate    func(template *AppPodTemplate)
+		wantField string
+	}{
+		{name: "valid", mutate: func(template *AppPodTemplate) {}},
+		{name: "missing namespace", mutate: func(template *AppPodTemplate) { template.Namespace = "" }, wantField: "Namespace"},
+		{name: "uppercase namespace", mutate: func(template *AppPodTemplate) { template.Namespace = "Trade" }, wantField: "Namespace"},
+		{name: "missing app name", mutate: func(template *AppPodTemplate) { template.AppName = "" }, wantField: "AppName"},
+		{name: "app name not a label", mutate: func(template *AppPodTemplate) { template.AppName = "order service" }, wantField: "AppName"},
+		{name: "missing app id", mutate: func(template *AppPodTemplate) { template.AppID = "" }, wantField: "AppID"},
+		{name: "missing image", mutate: func(template *AppPodTemplate) { template.Image = "" }, wantField: "Image"},
+		{name: "missing quota", mutate: func(template *AppPodTemplate) { template.K8sQuota = nil }, wantField: "K8sQuota"},
+		{name: "missing pod name", mutate: func(template *AppPodTemplate) { template.PodName = "" }, wantField: "PodName"},
+		{name: "invalid pod name", mutate: func(template *AppPodTemplate) { template.PodName = "Order_1" }, wantField: "PodName"},
+		{name: "invalid hostname", mutate: func(template *AppPodTemplate) { template.Hostname = "order.fat" }, wantField: "Hostname"},
+		{name: "invalid pod ip", mutate: func(template *AppPodTemplate) { template.PodIP = "10.0.0" }, wantField: "PodIP"},
+		{name: "invalid dns", mutate: func(template *AppPodTemplate) { template.Dns = "dns" }, wantField: "Dns"},
+		{name: "invalid port", mutate: func(template *AppPodTemplate) { template.Port = 70000 }, wantField: "Port"},
+		{name: "valid sysctl", mutate: func(template *AppPodTemplate) { template.Sysctl = "net.core.somaxconn=1024, net.ipv4.tcp_syncookies=1" }},
+		{name: "sysctl without value", mutate: func(template *AppPodTemplate) { template.Sysctl = "net.core.somaxconn" }, wantField: "Sysctl[0]"},
+		{name: "invalid sysctl name", mutate: func(template *AppPodTemplate) { template.Sysctl = "a=1,Net..core=1" }, wantField: "Sysctl[1]"},
+		{name: "invalid timezone", mutate: func(template *AppPodTemplate) { template.Timezone = "Mars/Olympus" }, wantField: "Timezone"},
+		{name: "anti affinity none", mutate: func(template *AppPodTemplate) { template.Scheduling.PodAntiAffinity = AntiAffinityNone }},
+		{name: "unknown anti affinity", mutate: func(template *AppPodTemplate) { template.Scheduling.PodAntiAffinity = "always" }, wantField: "Scheduling.PodAntiAffinity"},
+		{name: "invalid config name", mutate: func(template *AppPodTemplate) { template.Configs = []*AppConfig{{Name: "App_Config"}} }, wantField: "Configs[0].Name"},
+		{name: "secret env without key", mutate: func(template *AppPodTemplate) {
+			template.SecretEnvs = []SecretEnv{{Name: "DB_PASSWORD", SecretName: "db"}}
+		}, wantField: "SecretEnvs[0].Key"},
+		{name: "duplicate sidecar", mutate: func(template *AppPodTemplate) {
+			template.Sidecars = []Sidecar{{Name: "filebeat", Image: "filebeat"}, {Name: "filebeat", Image: "filebeat"}}
+		}, wantField: "Sidecars[1].Name"},
+		{name: "sidecar named like app container", mutate: func(template *AppPodTemplate) {
+			template.Sidecars = []Sidecar{{Name: "order-service", Image: "filebeat"}}
+		}, wantField: "Sidecars[0].Name"},
+		{name: "init container named like sidecar", mutate: func(template *AppPodTemplate) {
+			template.Sidecars = []Sidecar{{Name: "filebeat", Image: "filebeat"}}
+			template.InitContainers = []Sidecar{{Name: "filebeat", Image: "filebeat"}}
+		}, wantField: "InitContainers[0].Name"},
+		{name: "sidecar mounts shared volume", mutate: func(template *AppPodTemplate) {
+			template.SharedVolumes = []SharedVolume{{Name: "logs", MountPath: "/app/logs"}}
+			template.Sidecars = []Sidecar{{Name: "filebeat", Image: "filebeat", VolumeMounts: []v1.VolumeMount{{Name: "logs", MountPath: "/logs"}}}}
+		}},
+		{name: "sidecar mounts undeclared volume", mutate: func(template *AppPodTemplate) {
+			template.Sidecars = []Sidecar{{Name: "filebeat", Image: "filebeat", VolumeMounts: []v1.VolumeMount{{Name: "meminfo", MountPath: "/proc/meminfo"}}}}
+		}, wantField: "Sidecars[0].VolumeMounts[0].Name"},
+		{name: "shared volume named like lxcfs", mutate: func(template *AppPodTemplate) {
+			template.SharedVolumes = []SharedVolume{{Name: "meminfo"}}
+		}, wantField: "SharedVolumes[0].Name"},
+		{name: "shared volume named like localtime", mutate: func(template *AppPodTemplate) {
+			template.SharedVolumes = []SharedVolume{{Name: "localtime"}}
+		}, wantField: "SharedVolumes[0].Name"},
+		{name: "shared volume named like config", mutate: func(template *AppPodTemplate) {
+			template.Configs = []*AppConfig{{Name: "app"}}
+			template.SharedVolumes = []SharedVolume{{Name: "config-app"}}
+		}, wantField: "SharedVolumes[0].Name"},
+		{name: "shared volume named like data", mutate: func(template *AppPodTemplate) {
+			template.SharedVolumes = []SharedVolume{{Name: "data"}}
+		}, wantField: "SharedVolumes[0].Name"},
+		{name: "relative data volume", mutate: func(template *AppPodTemplate) {
+			template.DataVolume = &DataVolume{MountPath: "data", Size: resource.MustParse("10Gi")}
+		}, wantField: "DataVolume.MountPath"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := validTemplate()
+			tt.mutate(template)
+			errs := template.Validate()
+			if len(tt.wantField) == 0 {
+				if len(errs) > 0 {
+					t.Fatalf("Validate() = %v, want no errors", errs)
+				}
+				return
+			}
+			for _, err := range errs {
+				if err.Field == tt.wantField {
+					return
+				}
+			}
+			t.Errorf("Validate() = %v, want an error on %s", errs, tt.wantField)
+		})
+	}
+}
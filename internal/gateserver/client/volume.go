@@ -0,0 +1,169 @@
+package client
+
+import (
+	"cicd_go/internal/gateserver/remote"
+	"context"
+	"github.com/google/martian/log"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"strings"
+)
+
+const (
+	dataVolumeName = "data"
+)
+
+// DataVolume 应用实例的数据盘, StorageClass 为空时使用 emptyDir 并限制容器的 ephemeral-storage,
+// 否则为每个实例创建一个 PVC, 实例重建后数据仍然保留
+type DataVolume struct {
+	MountPath    string
+	Size         resource.Quantity
+	StorageClass string
+}
+
+// DataVolumeFromSpec 按 InstanceSpec.Disk 生成数据盘, Disk 单位为 GiB, 为 0 时返回 nil
+func DataVolumeFromSpec(spec *remote.InstanceSpec, mountPath, storageClass string) *DataVolume {
+	if spec.Disk <= 0 {
+		return nil
+	}
+	return &DataVolume{
+		MountPath:    mountPath,
+		Size:         *resource.NewQuantity(int64(spec.Disk*1024)*1024*1024, resource.BinarySI),
+		StorageClass: storageClass,
+	}
+}
+
+func AppPVCName(podName string) string {
+	return dataVolumeName + "-" + podName
+}
+
+func applyDataVolume(template *AppPodTemplate, podSpec *v1.PodSpec, container *v1.Container) {
+	dataVolume := template.DataVolume
+	if dataVolume == nil {
+		return
+	}
+
+	v1Volume := v1.Volume{}
+	v1Volume.Name = dataVolumeName
+	if len(dataVolume.StorageClass) > 0 {
+		v1Volume.PersistentVolumeClaim = &v1.PersistentVolumeClaimVolumeSource{ClaimName: AppPVCName(template.PodName)}
+	} else {
+		sizeLimit := dataVolume.Size.DeepCopy()
+		v1Volume.EmptyDir = &v1.EmptyDirVolumeSource{SizeLimit: &sizeLimit}
+
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = v1.ResourceList{}
+		}
+		if container.Resources.Limits == nil {
+			container.Resources.Limits = v1.ResourceList{}
+		}
+		container.Resources.Requests[v1.ResourceEphemeralStorage] = dataVolume.Size.DeepCopy()
+		container.Resources.Limits[v1.ResourceEphemeralStorage] = dataVolume.Size.DeepCopy()
+	}
+	podSpec.Volumes = append(podSpec.Volumes, v1Volume)
+
+	v1VolumeMount := v1.VolumeMount{}
+	v1VolumeMount.Name = dataVolumeName
+	v1VolumeMount.MountPath = dataVolume.MountPath
+	container.VolumeMounts = append(container.VolumeMounts, v1VolumeMount)
+}
+
+// ensureAppPVC 为实例创建数据盘 PVC, 已存在时直接复用
+func (c *Conf) ensureAppPVC(ctx context.Context, template *AppPodTemplate) error {
+	dataVolume := template.DataVolume
+	if dataVolume == nil || len(dataVolume.StorageClass) == 0 {
+		return nil
+	}
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.APIVersion = "v1"
+	pvc.Kind = "PersistentVolumeClaim"
+
+	labels := make(map[string]string)
+	labels["app"] = template.AppName
+	labels["appid"] = template.AppID
+	labels["instance"] = template.PodName
+	pvc.ObjectMeta = metav1.ObjectMeta{Name: AppPVCName(template.PodName), Namespace: template.Namespace, Labels: labels}
+
+	storageClass := dataVolume.StorageClass
+	pvc.Spec.StorageClassName = &storageClass
+	pvc.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
+	pvc.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: dataVolume.Size.DeepCopy()}
+
+	_, err = clientset.CoreV1().PersistentVolumeClaims(template.Namespace).Create(ctx, pvc, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("PVC created,namespace:%s,name:%s,size:%s", pvc.Namespace, pvc.Name, dataVolume.Size.String())
+	return nil
+}
+
+// DeleteInstanceVolume 实例下线后删除其数据盘
+func (c *Conf) DeleteInstanceVolume(ctx context.Context, namespace, podName string) (err error) {
+	defer c.wrapError(&err, "DeleteInstanceVolume", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	propagationPolicy := metav1.DeletePropagationBackground
+	dele := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+	err = clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, AppPVCName(podName), dele)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteAppVolumes 应用下线后删除所有实例的数据盘
+func (c *Conf) DeleteAppVolumes(ctx context.Context, namespace, appName string) (err error) {
+	defer c.wrapError(&err, "DeleteAppVolumes", namespace, appName)
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	opts := metav1.ListOptions{LabelSelector: "app=" + appName}
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	propagationPolicy := metav1.DeletePropagationBackground
+	dele := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+	for _, pvc := range pvcs.Items {
+		if !strings.HasPrefix(pvc.Name, dataVolumeName+"-") {
+			continue
+		}
+		err = clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvc.Name, dele)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		log.Infof("PVC deleted,namespace:%s,name:%s", namespace, pvc.Name)
+	}
+	return nil
+}
+
+func validateDataVolume(dataVolume *DataVolume, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if dataVolume == nil {
+		return allErrs
+	}
+	if !strings.HasPrefix(dataVolume.MountPath, "/") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("MountPath"), dataVolume.MountPath, "must be an absolute path"))
+	}
+	if dataVolume.Size.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("Size"), dataVolume.Size.String(), "must be greater than zero"))
+	}
+	if len(dataVolume.StorageClass) > 0 {
+		allErrs = append(allErrs, validateDNS1123Subdomain(dataVolume.StorageClass, fldPath.Child("StorageClass"))...)
+	}
+	return allErrs
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+const (
+	podPollInterval     = 2 * time.Second
+	podDeleteTimeout    = 3 * time.Minute
+	podReadinessTimeout = 5 * time.Minute
+)
+
+// WaitAppPodDeleted 等待 pod 从 apiserver 中彻底消失
+func (c *Conf) WaitAppPodDeleted(ctx context.Context, namespace, podName string, timeout time.Duration) (err error) {
+	defer c.wrapError(&err, "WaitAppPodDeleted", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	return wait.PollImmediateWithContext(ctx, podPollInterval, timeout, func(ctx context.Context) (bool, error) {
+		_, getErr := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if apierrors.IsNotFound(getErr) {
+			return true, nil
+		}
+		return false, getErr
+	})
+}
+
+// WaitAppPodReady 等待 pod 的 Ready condition 变为 True
+func (c *Conf) WaitAppPodReady(ctx context.Context, namespace, podName string, timeout time.Duration) (err error) {
+	defer c.wrapError(&err, "WaitAppPodReady", namespace, "")
+	clientset, err := c.clientset()
+	if err != nil {
+		return err
+	}
+	return wait.PollImmediateWithContext(ctx, podPollInterval, timeout, func(ctx context.Context) (bool, error) {
+		pod, getErr := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if apierrors.IsNotFound(getErr) {
+			return false, nil
+		}
+		if getErr != nil {
+			return false, getErr
+		}
+		return isPodReady(pod), nil
+	})
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
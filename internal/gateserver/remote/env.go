@@ -9,6 +9,7 @@ type ENV struct {
 	Nginx string `json:"nginx"`
 	DNS string `json:"dns"`
 	DockerYard string `json:"docker_yard"`
+	HostAliases []HostAlias `json:"host_aliases"`
 	IsInUse bool `json:"is_in_use"`
 	EnableHa bool `json:"enable_ha"`
 	Description string `json:"description"`
@@ -0,0 +1,6 @@
+package remote
+
+type HostAlias struct {
+	IP string `json:"ip"`
+	Hostnames []string `json:"hostnames"`
+}
\ No newline at end of file
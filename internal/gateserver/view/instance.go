@@ -0,0 +1,158 @@
+package view
+
+import (
+	"cicd_go/internal/gateserver/client"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Instance 页面展示的单个实例, 由 pod 汇总而来
+type Instance struct {
+	InstanceName          string     `json:"instance_name"`
+	AppID                 string     `json:"app_id"`
+	AppName               string     `json:"app_name"`
+	Namespace             string     `json:"namespace"`
+	IP                    string     `json:"ip"`
+	Node                  string     `json:"node"`
+	NodeIP                string     `json:"node_ip"`
+	Image                 string     `json:"image"`
+	ImageTag              string     `json:"image_tag"`
+	Phase                 string     `json:"phase"`
+	Ready                 bool       `json:"ready"`
+	RestartCount          int32      `json:"restart_count"`
+	LastTerminationReason string     `json:"last_termination_reason"`
+	StartTime             *time.Time `json:"start_time"`
+	Age                   string     `json:"age"`
+	RequestCPU            string     `json:"request_cpu"`
+	RequestMemory         string     `json:"request_memory"`
+	LimitCPU              string     `json:"limit_cpu"`
+	LimitMemory           string     `json:"limit_memory"`
+}
+
+// AppInstances 应用所有实例及汇总数据
+type AppInstances struct {
+	AppName       string      `json:"app_name"`
+	Total         int         `json:"total"`
+	Ready         int         `json:"ready"`
+	Running       int         `json:"running"`
+	Pending       int         `json:"pending"`
+	Failed        int         `json:"failed"`
+	Restarts      int32       `json:"restarts"`
+	RequestCPU    string      `json:"request_cpu"`
+	RequestMemory string      `json:"request_memory"`
+	Instances     []*Instance `json:"instances"`
+}
+
+func imageTag(image string) string {
+	// digest 形式 repo@sha256:xxx 直接返回 digest
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i+1:], "/") {
+		return "latest"
+	}
+	return image[i+1:]
+}
+
+func appContainerStatus(pod *v1.Pod, containerName string) *v1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == containerName {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+func NewInstance(pod *v1.Pod, now time.Time) *Instance {
+	appName := pod.Labels["app"]
+	instance := &Instance{
+		InstanceName: pod.Name,
+		AppID:        pod.Labels["appid"],
+		AppName:      appName,
+		Namespace:    pod.Namespace,
+		IP:           pod.Status.PodIP,
+		Node:         pod.Spec.NodeName,
+		NodeIP:       pod.Status.HostIP,
+		Phase:        string(pod.Status.Phase),
+	}
+	if len(instance.IP) == 0 {
+		instance.IP = pod.Labels["ip"]
+	}
+	if pod.DeletionTimestamp != nil {
+		instance.Phase = "Terminating"
+	}
+
+	containerName := client.AppContainerName(appName)
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			instance.Image = container.Image
+			instance.ImageTag = imageTag(container.Image)
+		}
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			instance.Ready = condition.Status == v1.ConditionTrue
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		instance.RestartCount += status.RestartCount
+	}
+	if status := appContainerStatus(pod, containerName); status != nil && status.LastTerminationState.Terminated != nil {
+		instance.LastTerminationReason = status.LastTerminationState.Terminated.Reason
+	}
+
+	if pod.Status.StartTime != nil {
+		startTime := pod.Status.StartTime.Time
+		instance.StartTime = &startTime
+		instance.Age = duration.HumanDuration(now.Sub(startTime))
+	} else if !pod.CreationTimestamp.IsZero() {
+		instance.Age = duration.HumanDuration(now.Sub(pod.CreationTimestamp.Time))
+	}
+
+	requests, limits := client.PodResources(&pod.Spec)
+	instance.RequestCPU = requests.Cpu().String()
+	instance.RequestMemory = requests.Memory().String()
+	instance.LimitCPU = limits.Cpu().String()
+	instance.LimitMemory = limits.Memory().String()
+	return instance
+}
+
+func NewAppInstances(appName string, pods []v1.Pod, now time.Time) *AppInstances {
+	app := &AppInstances{AppName: appName}
+	var requestCPU, requestMemory resource.Quantity
+	for i := range pods {
+		pod := &pods[i]
+		instance := NewInstance(pod, now)
+		app.Instances = append(app.Instances, instance)
+
+		app.Total++
+		if instance.Ready {
+			app.Ready++
+		}
+		switch pod.Status.Phase {
+		case v1.PodRunning:
+			app.Running++
+		case v1.PodPending:
+			app.Pending++
+		case v1.PodFailed:
+			app.Failed++
+		}
+		app.Restarts += instance.RestartCount
+
+		requests, _ := client.PodResources(&pod.Spec)
+		requestCPU.Add(*requests.Cpu())
+		requestMemory.Add(*requests.Memory())
+	}
+	app.RequestCPU = requestCPU.String()
+	app.RequestMemory = requestMemory.String()
+	sort.Slice(app.Instances, func(i, j int) bool {
+		return app.Instances[i].InstanceName < app.Instances[j].InstanceName
+	})
+	return app
+}